@@ -0,0 +1,143 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+// conflictDescriptions describes the XY codes of unmerged entries.
+var conflictDescriptions = map[string]string{
+	"DD": "both deleted",
+	"AU": "added by us",
+	"UD": "deleted by them",
+	"UA": "added by them",
+	"DU": "deleted by us",
+	"AA": "both added",
+	"UU": "both modified",
+}
+
+// conflicts returns the unmerged entries in the git status.
+func conflicts(r GitRunner, d *command.Data) ([]*StatusEntry, error) {
+	entries, err := gitStatus(r, d, "")
+	if err != nil {
+		return nil, err
+	}
+	var cs []*StatusEntry
+	for _, e := range entries {
+		if e.Type == UnmergedEntry {
+			cs = append(cs, e)
+		}
+	}
+	return cs, nil
+}
+
+// ConflictCompleter completes the files that have merge conflicts (read with a
+// ShellGitRunner).
+func ConflictCompleter[T any]() commander.Completer[T] {
+	return conflictCompleter[T](&ShellGitRunner{})
+}
+
+func conflictCompleter[T any](r GitRunner) commander.Completer[T] {
+	return commander.CompleterFromFunc(func(t T, d *command.Data) (*command.Completion, error) {
+		cs, err := conflicts(r, d)
+		if err != nil {
+			return nil, err
+		}
+		var suggestions []string
+		for _, c := range cs {
+			suggestions = append(suggestions, c.Path)
+		}
+		return &command.Completion{
+			Distinct:        true,
+			Suggestions:     suggestions,
+			CaseInsensitive: true,
+		}, nil
+	})
+}
+
+func (g *git) printConflicts(o command.Output, d *command.Data) error {
+	cs, err := conflicts(g.gitRunner(), d)
+	if err != nil {
+		return o.Err(err)
+	}
+	if len(cs) == 0 {
+		o.Stdoutln("No conflicts")
+		return nil
+	}
+	for _, c := range cs {
+		desc, ok := conflictDescriptions[c.XY]
+		if !ok {
+			desc = c.XY
+		}
+		o.Stdoutf("%s (%s)\n", c.Path, desc)
+	}
+	return nil
+}
+
+// resolveConflicts returns a processor that resolves the conflicted files
+// returned by files by checking out the provided side (`ours` or `theirs`) and
+// marking the files as resolved. Files that were deleted on the provided side
+// are removed instead. Note that during a rebase, `ours` is the branch being rebased onto
+// and `theirs` is the branch being rebased.
+func (g *git) resolveConflicts(side string, files func(*command.Data) []string) command.Processor {
+	return g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+		cs, err := conflicts(g.gitRunner(), d)
+		if err != nil {
+			return nil, o.Err(err)
+		}
+		// The first letter of the XY code is our side's status and the second
+		// letter is their side's.
+		idx := 0
+		if side == "theirs" {
+			idx = 1
+		}
+		deleted := map[string]bool{}
+		for _, c := range cs {
+			if len(c.XY) == 2 && c.XY[idx] == 'D' {
+				deleted[c.Path] = true
+			}
+		}
+
+		var checkout, remove []string
+		for _, f := range files(d) {
+			if deleted[f] {
+				remove = append(remove, f)
+			} else {
+				checkout = append(checkout, f)
+			}
+		}
+
+		var cmds [][]string
+		if len(checkout) > 0 {
+			cmds = append(cmds,
+				append([]string{"checkout", fmt.Sprintf("--%s", side), "--"}, checkout...),
+				append([]string{"add", "--"}, checkout...),
+			)
+		}
+		if len(remove) > 0 {
+			cmds = append(cmds, append([]string{"rm", "--"}, remove...))
+		}
+		return gitExecution(cmds...), nil
+	})
+}
+
+// noConflictsProcessor fails if there are any unresolved conflicts.
+func (g *git) noConflictsProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+		cs, err := conflicts(g.gitRunner(), d)
+		if err != nil {
+			return o.Err(err)
+		}
+		if len(cs) == 0 {
+			return nil
+		}
+		var paths []string
+		for _, c := range cs {
+			paths = append(paths, c.Path)
+		}
+		return o.Stderrf("cannot continue while conflicts remain (resolve them with `g ours` or `g theirs`): %s\n", strings.Join(paths, ", "))
+	}, nil)
+}
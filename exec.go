@@ -0,0 +1,145 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	directFlag = commander.BoolFlag("direct", 'x', "Run git commands directly rather than generating shell commands")
+)
+
+// execution is the sequence of commands that a command runs.
+type execution struct {
+	// program is the executable that the commands in git run if it isn't git
+	// (e.g. `rm`).
+	program string
+	// git is the args for each git command, in the order they are run.
+	git [][]string
+	// success is output once all of the git commands succeed.
+	success string
+	// cd is a directory to cd into once all of the git commands succeed. This is
+	// always done with a shell command since a child process can't change the
+	// shell's directory.
+	cd string
+}
+
+// gitExecution returns an execution that runs the provided git commands.
+func gitExecution(cmds ...[]string) *execution {
+	return &execution{git: cmds}
+}
+
+// programExecution returns an execution that runs a program other than git.
+func programExecution(program string, args ...string) *execution {
+	return &execution{program: program, git: [][]string{args}}
+}
+
+// programName returns the name of the executable that the commands run.
+func (e *execution) programName() string {
+	if e.program != "" {
+		return e.program
+	}
+	return "git"
+}
+
+// shellCommands returns the execution as shell commands for the current OS.
+// Multiple commands are joined so that they stop at the first failure.
+func (e *execution) shellCommands() []string {
+	var cmds []string
+	for _, args := range e.git {
+		cmds = append(cmds, shellCommand(e.programName(), args...))
+	}
+	if e.success != "" {
+		cmds = append(cmds, fmt.Sprintf("echo %s", e.success))
+	}
+	if e.cd != "" {
+		cmds = append(cmds, fmt.Sprintf("cd %s", shellQuote(e.cd)))
+	}
+	if len(cmds) <= 1 {
+		return cmds
+	}
+	return joinByOS(cmds...)
+}
+
+// gitShellCommand returns the shell command that runs git with the args.
+func gitShellCommand(args ...string) string {
+	return shellCommand("git", args...)
+}
+
+// shellCommand returns the shell command that runs the program with the args.
+func shellCommand(program string, args ...string) string {
+	if len(args) == 0 {
+		return program
+	}
+	return fmt.Sprintf("%s %s", program, shellQuote(args...))
+}
+
+// direct returns whether git commands should be run directly (rather than
+// through shell commands).
+func (g *git) direct(d *command.Data) bool {
+	return g.DirectExecution || directFlag.Get(d)
+}
+
+// executable returns a processor that runs the commands returned by f.
+//
+// By default, the commands are converted to shell commands (see
+// shellCommands). In direct mode (see `g cfg direct` and the `--direct` flag),
+// git (or the execution's program) is run with the args of each command (so
+// nothing depends on the user's shell). Output is streamed and execution stops
+// at the first failure. In dry-run mode, the args of each command are output
+// instead.
+func (g *git) executable(f func(o command.Output, d *command.Data) (*execution, error)) command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+		e, err := f(o, d)
+		if err != nil || e == nil {
+			return err
+		}
+
+		if !g.direct(d) {
+			ed.Executable = append(ed.Executable, e.shellCommands()...)
+			return nil
+		}
+
+		if e.cd != "" {
+			ed.Executable = append(ed.Executable, fmt.Sprintf("cd %s", shellQuote(e.cd)))
+		}
+		if len(e.git) == 0 && e.success == "" {
+			return nil
+		}
+		program := e.programName()
+		if dryRunFlag.Get(d) {
+			for _, args := range e.git {
+				o.Stdoutf("%q\n", append([]string{program}, args...))
+			}
+			return nil
+		}
+		ed.Executor = append(ed.Executor, func(o command.Output, d *command.Data) error {
+			for _, args := range e.git {
+				if err := g.gitRunner().Run(o, d, program, args...); err != nil {
+					return o.Annotatef(err, "failed to run %s", shellCommand(program, args...))
+				}
+			}
+			if e.success != "" {
+				o.Stdoutln(e.success)
+			}
+			return nil
+		})
+		return nil
+	}, nil)
+}
+
+// gitExecutable returns a processor that runs the provided constant git
+// commands. Each command is the space-separated args that are passed to git
+// (see executable).
+func (g *git) gitExecutable(cmds ...string) command.Processor {
+	return g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+		var r [][]string
+		for _, c := range cmds {
+			r = append(r, strings.Fields(c))
+		}
+		return gitExecution(r...), nil
+	})
+}
@@ -0,0 +1,249 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+)
+
+// FakeGitRunner is an in-memory GitRunner. Each method returns an error if the
+// corresponding field isn't set (just like git would outside of a repo, or on
+// a detached HEAD, etc.).
+type FakeGitRunner struct {
+	// Branch is the checked out branch.
+	Branch string
+	// RootDir is the repo's top-level directory.
+	RootDir string
+	// URL is the url of the origin remote.
+	URL string
+	// ID is the repo's identity (see GitRunner.RepoID).
+	ID string
+	// Head is the branch that the origin remote's HEAD points to.
+	Head string
+	// LocalBranches are the local branches. The branch that matches Branch is
+	// returned as the current branch and branches that are checked out in
+	// WorktreeList are returned as checked out in another worktree.
+	LocalBranches []string
+	// DirBranches maps other repo directories to their local branches.
+	DirBranches map[string][]string
+	// Tips maps local branches to the commits that they point to.
+	Tips map[string]string
+	// Merged maps base branches to the branches that are merged into them.
+	Merged map[string][]string
+	// Squashed maps base branches to the branches that were squash-merged into
+	// them.
+	Squashed map[string][]string
+	// MergeBases maps pairs of commits to their merge-base.
+	MergeBases map[[2]string]string
+	// FirstParents maps branches to the commits in their first-parent history.
+	FirstParents map[string][]string
+	// Counts maps (parent, branch) pairs to the number of commits that the
+	// branch is ahead of and behind the parent.
+	Counts map[[2]string][2]int
+	// Diffs maps the space-separated `git diff` args to the changed paths.
+	Diffs map[string][]string
+	// Statuses maps worktree directories to their status entries. The current
+	// directory's entries are under the empty string.
+	Statuses map[string][]*StatusEntry
+	// WorktreeList are the repo's worktrees.
+	WorktreeList []*Worktree
+	// Err, if set, is returned by every method.
+	Err error
+
+	// Pushed are the branches that were pushed with PushUpstream.
+	Pushed []string
+	// Ran are the commands (program and args) that were run with Run.
+	Ran [][]string
+}
+
+func (f *FakeGitRunner) CurrentBranch(o command.Output, d *command.Data) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if f.Branch == "" {
+		return "", fmt.Errorf("no branch is checked out")
+	}
+	return f.Branch, nil
+}
+
+func (f *FakeGitRunner) Root(o command.Output, d *command.Data) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if f.RootDir == "" {
+		return "", fmt.Errorf("not a git repository")
+	}
+	return f.RootDir, nil
+}
+
+func (f *FakeGitRunner) RemoteURL(o command.Output, d *command.Data) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if f.URL == "" {
+		return "", fmt.Errorf("no origin remote")
+	}
+	return f.URL, nil
+}
+
+func (f *FakeGitRunner) RepoID(o command.Output, d *command.Data) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if f.ID == "" {
+		return "", fmt.Errorf("not a git repository")
+	}
+	return f.ID, nil
+}
+
+func (f *FakeGitRunner) RemoteHead(o command.Output, d *command.Data) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if f.Head == "" {
+		return "", fmt.Errorf("no origin HEAD ref")
+	}
+	return f.Head, nil
+}
+
+func (f *FakeGitRunner) QueryRemoteHead(o command.Output, d *command.Data) (string, error) {
+	return f.RemoteHead(o, d)
+}
+
+func (f *FakeGitRunner) Branches(o command.Output, d *command.Data, dir string) ([]*Branch, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if dir != "" {
+		bs, ok := f.DirBranches[dir]
+		if !ok {
+			return nil, fmt.Errorf("not a git repository: %s", dir)
+		}
+		var r []*Branch
+		for _, b := range bs {
+			r = append(r, &Branch{Name: b})
+		}
+		return r, nil
+	}
+	worktrees := map[string]bool{}
+	for _, wt := range f.WorktreeList {
+		worktrees[wt.Branch] = true
+	}
+	var r []*Branch
+	for _, b := range f.LocalBranches {
+		r = append(r, &Branch{
+			Name:     b,
+			Current:  b == f.Branch,
+			Worktree: b != f.Branch && worktrees[b],
+		})
+	}
+	return r, nil
+}
+
+func (f *FakeGitRunner) BranchTips(o command.Output, d *command.Data) (map[string]string, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Tips, nil
+}
+
+func (f *FakeGitRunner) MergedBranches(o command.Output, d *command.Data, base string) ([]string, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Merged[base], nil
+}
+
+func (f *FakeGitRunner) SquashMerged(o command.Output, d *command.Data, base, branch string) (bool, error) {
+	if f.Err != nil {
+		return false, f.Err
+	}
+	for _, b := range f.Squashed[base] {
+		if b == branch {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *FakeGitRunner) MergeBase(o command.Output, d *command.Data, a, b string) (string, error) {
+	if f.Err != nil {
+		return "", f.Err
+	}
+	mb, ok := f.MergeBases[[2]string{a, b}]
+	if !ok {
+		return "", fmt.Errorf("no merge base for %s and %s", a, b)
+	}
+	return mb, nil
+}
+
+func (f *FakeGitRunner) FirstParentContains(o command.Output, d *command.Data, branch, commit string) (bool, error) {
+	if f.Err != nil {
+		return false, f.Err
+	}
+	for _, c := range f.FirstParents[branch] {
+		if c == commit {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *FakeGitRunner) AheadBehind(o command.Output, d *command.Data, parent, branch string) (int, int, error) {
+	if f.Err != nil {
+		return 0, 0, f.Err
+	}
+	c, ok := f.Counts[[2]string{parent, branch}]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown revision %s...%s", parent, branch)
+	}
+	return c[0], c[1], nil
+}
+
+func (f *FakeGitRunner) DiffNameStatus(o command.Output, d *command.Data, args ...string) ([]string, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Diffs[strings.Join(args, " ")], nil
+}
+
+func (f *FakeGitRunner) Status(o command.Output, d *command.Data, dir string) ([]*StatusEntry, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	entries, ok := f.Statuses[dir]
+	if !ok && dir != "" {
+		return nil, fmt.Errorf("not a git repository: %s", dir)
+	}
+	return entries, nil
+}
+
+func (f *FakeGitRunner) Worktrees(o command.Output, d *command.Data) ([]*Worktree, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.RootDir == "" {
+		return nil, fmt.Errorf("not a git repository")
+	}
+	return f.WorktreeList, nil
+}
+
+func (f *FakeGitRunner) PushUpstream(o command.Output, d *command.Data, branch string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.URL == "" {
+		return fmt.Errorf("no origin remote")
+	}
+	f.Pushed = append(f.Pushed, branch)
+	return nil
+}
+
+func (f *FakeGitRunner) Run(o command.Output, d *command.Data, program string, args ...string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Ran = append(f.Ran, append([]string{program}, args...))
+	return nil
+}
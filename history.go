@@ -0,0 +1,174 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+// branchHistorySize is the maximum number of branches kept in a repo's
+// branch history.
+const branchHistorySize = 20
+
+var (
+	// Stubbed in tests
+	timeNow = time.Now
+
+	pbArg = commander.OptionalArg[int]("N", "Number of entries to go back in the branch history", commander.Positive[int](), commander.Default(1))
+)
+
+// BranchVisit is an entry in a repo's branch history.
+type BranchVisit struct {
+	Branch string
+	// Time is when the branch was checked out of. This is the zero time for
+	// entries migrated from older configs.
+	Time time.Time
+}
+
+// recordCheckout adds the branch being checked out of to the front of the
+// repo's branch history. The branch being checked out is removed from the
+// history since it is now the current branch.
+func (g *git) recordCheckout(gitRoot, from, to string) {
+	if from == to {
+		return
+	}
+
+	h := []*BranchVisit{{Branch: from, Time: timeNow()}}
+	for _, v := range g.BranchHistory[gitRoot] {
+		if v.Branch != from && v.Branch != to {
+			h = append(h, v)
+		}
+	}
+	if len(h) > branchHistorySize {
+		h = h[:branchHistorySize]
+	}
+
+	if g.BranchHistory == nil {
+		g.BranchHistory = map[string][]*BranchVisit{}
+	}
+	g.BranchHistory[gitRoot] = h
+	g.changed = true
+}
+
+// filterHistory removes all branch history entries for which keep returns false.
+func (g *git) filterHistory(keep func(gitRoot string, v *BranchVisit) bool) {
+	for gitRoot, h := range g.BranchHistory {
+		var r []*BranchVisit
+		for _, v := range h {
+			if keep(gitRoot, v) {
+				r = append(r, v)
+			}
+		}
+		if len(r) == len(h) {
+			continue
+		}
+		if len(r) == 0 {
+			delete(g.BranchHistory, gitRoot)
+		} else {
+			g.BranchHistory[gitRoot] = r
+		}
+		g.changed = true
+	}
+}
+
+// repoHistoryRoots returns the git roots of the current repo's worktrees,
+// which are the keys of the repo's branch histories. git is only run if there
+// is any branch history.
+func (g *git) repoHistoryRoots(d *command.Data) (map[string]bool, error) {
+	if len(g.BranchHistory) == 0 {
+		return nil, nil
+	}
+	wts, err := worktrees(g.gitRunner(), d)
+	if err != nil {
+		return nil, err
+	}
+	r := map[string]bool{}
+	for _, wt := range wts {
+		r[wt.Path] = true
+	}
+	return r, nil
+}
+
+func (g *git) previousBranch(o command.Output, d *command.Data) (*execution, error) {
+	gitRoot := gitRootDir.Get(d)
+	h := g.BranchHistory[gitRoot]
+	if len(h) == 0 {
+		return nil, o.Stderrln("no previous branch exists")
+	}
+
+	n := pbArg.Get(d)
+	if n > len(h) {
+		return nil, o.Stderrf("only %d previous branch(es) exist\n", len(h))
+	}
+	branch := h[n-1].Branch
+	g.recordCheckout(gitRoot, currentBranchArg.Get(d), branch)
+	return gitExecution([]string{"checkout", branch}), nil
+}
+
+func (g *git) printHistory(o command.Output, d *command.Data) error {
+	h := g.BranchHistory[gitRootDir.Get(d)]
+	if len(h) == 0 {
+		o.Stdoutln("No branch history for this repo")
+		return nil
+	}
+
+	for idx, v := range h {
+		when := "unknown time"
+		if !v.Time.IsZero() {
+			when = v.Time.Format(time.DateTime)
+		}
+		o.Stdoutf("%d: %s (%s)\n", idx+1, v.Branch, when)
+	}
+	return nil
+}
+
+// recentBranchCompleter completes branch names. The local branches are
+// ordered by when they were last checked out (most recent first, per the
+// repo's history) so the likely targets aren't buried among every local
+// branch. Branches that aren't in the history follow in alphabetical order.
+func (g *git) recentBranchCompleter() commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, d *command.Data) (*command.Completion, error) {
+		c, err := branchCompletion(g.gitRunner(), s, d)
+		if err != nil {
+			return nil, err
+		}
+
+		recency := map[string]int{}
+		if len(g.BranchHistory) > 0 {
+			if gitRoot, err := g.gitRunner().Root(nil, d); err == nil {
+				for idx, v := range g.BranchHistory[gitRoot] {
+					if _, ok := recency[v.Branch]; !ok {
+						recency[v.Branch] = idx
+					}
+				}
+			}
+		}
+		// Suggestions without the user prefix are as recent as the full branch.
+		rank := func(b string) (int, bool) {
+			if idx, ok := recency[b]; ok {
+				return idx, true
+			}
+			idx, ok := recency[fmt.Sprintf("%s/%s", userArg.Get(d), b)]
+			return idx, ok
+		}
+		slices.SortFunc(c.Suggestions, func(a, b string) int {
+			ra, aok := rank(a)
+			rb, bok := rank(b)
+			switch {
+			case aok && bok && ra != rb:
+				return ra - rb
+			case aok != bok:
+				if aok {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a, b)
+		})
+		return c, nil
+	})
+}
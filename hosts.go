@@ -0,0 +1,154 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RemoteURL is a parsed git remote url.
+type RemoteURL struct {
+	// Scheme is the scheme used for the host's web UI (http or https).
+	Scheme string
+	// Host is the hostname (and port, if the web UI is served on a
+	// non-default port) of the remote.
+	Host string
+	// Hostname is the remote's hostname (without any port). This is used to
+	// look up the remote's HostProvider.
+	Hostname string
+	// Path is the repo path (e.g. `org/repo`), without the `.git` suffix.
+	Path string
+}
+
+// WebURL returns the url of the repo's web page.
+func (r *RemoteURL) WebURL() string {
+	return fmt.Sprintf("%s://%s/%s", r.Scheme, r.Host, r.Path)
+}
+
+// ParseRemoteURL parses a git remote url. Supported formats are scp-style
+// (`[user@]host:org/repo.git`) and urls (`ssh://`, `git://`, `http(s)://`),
+// including those with ports and credentials.
+func ParseRemoteURL(remote string) (*RemoteURL, error) {
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("Unknown git url format: %s", remote)
+		}
+
+		r := &RemoteURL{
+			Scheme:   "https",
+			Host:     u.Hostname(),
+			Hostname: u.Hostname(),
+			Path:     cleanRemotePath(u.Path),
+		}
+		// The port of an http(s) remote is also the port of the web UI. That
+		// isn't the case for ssh ports.
+		if u.Scheme == "http" || u.Scheme == "https" {
+			r.Scheme = u.Scheme
+			r.Host = u.Host
+		}
+		if r.Path == "" {
+			return nil, fmt.Errorf("Unknown git url format: %s", remote)
+		}
+		return r, nil
+	}
+
+	// scp-style
+	hostPart, path, ok := strings.Cut(remote, ":")
+	if !ok || strings.Contains(hostPart, "/") {
+		return nil, fmt.Errorf("Unknown git url format: %s", remote)
+	}
+	if _, host, hasUser := strings.Cut(hostPart, "@"); hasUser {
+		hostPart = host
+	}
+	r := &RemoteURL{
+		Scheme:   "https",
+		Host:     hostPart,
+		Hostname: hostPart,
+		Path:     cleanRemotePath(path),
+	}
+	if r.Hostname == "" || r.Path == "" {
+		return nil, fmt.Errorf("Unknown git url format: %s", remote)
+	}
+	return r, nil
+}
+
+func cleanRemotePath(path string) string {
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// HostProvider generates links for a type of git host.
+type HostProvider interface {
+	// PRLink returns the link for creating a pull request (or merge request)
+	// that merges branch into base.
+	PRLink(r *RemoteURL, base, branch string) string
+}
+
+// HostProviderFunc is a HostProvider backed by a function.
+type HostProviderFunc func(r *RemoteURL, base, branch string) string
+
+func (f HostProviderFunc) PRLink(r *RemoteURL, base, branch string) string {
+	return f(r, base, branch)
+}
+
+var (
+	// HostProviders is the set of host types that can be configured with
+	// `g cfg host set`.
+	HostProviders = map[string]HostProvider{
+		"github": HostProviderFunc(func(r *RemoteURL, base, branch string) string {
+			return fmt.Sprintf("%s/compare/%s...%s?expand=1", r.WebURL(), escapeBranch(base), escapeBranch(branch))
+		}),
+		"gitlab": HostProviderFunc(func(r *RemoteURL, base, branch string) string {
+			v := url.Values{}
+			v.Set("merge_request[source_branch]", branch)
+			v.Set("merge_request[target_branch]", base)
+			return fmt.Sprintf("%s/-/merge_requests/new?%s", r.WebURL(), v.Encode())
+		}),
+		"bitbucket": HostProviderFunc(func(r *RemoteURL, base, branch string) string {
+			v := url.Values{}
+			v.Set("source", branch)
+			v.Set("dest", base)
+			return fmt.Sprintf("%s/pull-requests/new?%s", r.WebURL(), v.Encode())
+		}),
+		"gitea": HostProviderFunc(func(r *RemoteURL, base, branch string) string {
+			return fmt.Sprintf("%s/compare/%s...%s", r.WebURL(), escapeBranch(base), escapeBranch(branch))
+		}),
+	}
+
+	// defaultHosts are the host types used for well-known hosts when no host
+	// type is configured.
+	defaultHosts = map[string]string{
+		"github.com":    "github",
+		"gitlab.com":    "gitlab",
+		"bitbucket.org": "bitbucket",
+		"codeberg.org":  "gitea",
+	}
+)
+
+// escapeBranch escapes a branch name for use in a url path. Each segment is
+// escaped separately so that the slashes in names like `user/feature` are
+// kept.
+func escapeBranch(branch string) string {
+	segments := strings.Split(branch, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// hostProvider returns the HostProvider for the provided remote.
+func (g *git) hostProvider(r *RemoteURL) (HostProvider, error) {
+	hostType, ok := g.Hosts[r.Hostname]
+	if !ok {
+		hostType, ok = defaultHosts[r.Hostname]
+	}
+	if !ok {
+		return nil, fmt.Errorf("No host type configured for %s (run `g cfg host set %s TYPE`)", r.Hostname, r.Hostname)
+	}
+
+	hp, ok := HostProviders[hostType]
+	if !ok {
+		return nil, fmt.Errorf("Unknown host type %q for %s", hostType, r.Hostname)
+	}
+	return hp, nil
+}
@@ -0,0 +1,604 @@
+package sourcecontrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+// testRepo is a throwaway repo (with a local bare repo as its origin remote)
+// that is created with the system git.
+type testRepo struct {
+	t *testing.T
+	// dir is the repo's top-level directory.
+	dir string
+	// id is the repo's identity (see GitRunner.RepoID).
+	id string
+}
+
+// integrationRemoteURL is the url of the origin remote. Git rewrites it to the
+// local bare repo (with `url.<base>.insteadOf`) so that pushes and pulls work
+// offline while PR links are still generated for a real host.
+const integrationRemoteURL = "git@github.com:user/repo.git"
+
+// newTestRepo creates a repo with a single commit on main that is pushed to
+// the origin remote.
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("integration tests are skipped in short mode")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("integration tests run the generated commands with sh")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Ignore the user's and the system's git config.
+	tmp := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(tmp, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	// Fix the commit dates so that the commit hashes (which git outputs) are
+	// the same for every run.
+	t.Setenv("GIT_AUTHOR_DATE", "2026-03-04T05:06:07Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2026-03-04T05:06:07Z")
+
+	remote := filepath.Join(tmp, "remote.git")
+	r := &testRepo{t: t, dir: filepath.Join(tmp, "repo")}
+	r.git(tmp, "init", "--bare", "--initial-branch=main", remote)
+	r.git(tmp, "init", "--initial-branch=main", r.dir)
+	for _, kv := range [][]string{
+		{"user.name", "Person"},
+		{"user.email", "person@example.com"},
+		{"commit.gpgsign", "false"},
+		{"status.relativePaths", "true"},
+		{fmt.Sprintf("url.%s.insteadOf", remote), integrationRemoteURL},
+	} {
+		r.git(r.dir, "config", kv[0], kv[1])
+	}
+	r.git(r.dir, "remote", "add", "origin", integrationRemoteURL)
+	r.commit("initial")
+	r.git(r.dir, "push", "--set-upstream", "origin", "main")
+
+	// Use the paths as git reports them (e.g. with symlinks resolved).
+	r.dir = r.run("rev-parse", "--show-toplevel")
+	r.id = r.run("rev-parse", "--path-format=absolute", "--git-common-dir")
+	return r
+}
+
+// git runs git with the args in dir and returns its trimmed stdout.
+func (r *testRepo) git(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		r.t.Fatalf("failed to run git %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// run runs git with the args in the repo and returns its trimmed stdout.
+func (r *testRepo) run(args ...string) string {
+	r.t.Helper()
+	return r.git(r.dir, args...)
+}
+
+// commit commits a new file on the current branch.
+func (r *testRepo) commit(name string) {
+	r.t.Helper()
+	r.write(name+".txt", name)
+	r.run("add", "--", name+".txt")
+	r.run("commit", "-m", name)
+}
+
+// write writes the contents to the file in the repo.
+func (r *testRepo) write(file, contents string) {
+	r.t.Helper()
+	if err := os.WriteFile(filepath.Join(r.dir, file), []byte(contents), 0644); err != nil {
+		r.t.Fatalf("failed to write file: %v", err)
+	}
+}
+
+// branches returns the local branches.
+func (r *testRepo) branches() []string {
+	r.t.Helper()
+	return strings.Split(r.run("for-each-ref", "--format=%(refname:short)", "refs/heads/"), "\n")
+}
+
+// execute runs the shell commands that a command generated in the repo.
+func (r *testRepo) execute(cmds []string) {
+	r.t.Helper()
+	for _, c := range cmds {
+		cmd := exec.Command("sh", "-c", c)
+		cmd.Dir = r.dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			r.t.Fatalf("failed to run %q: %v\n%s", c, err, out)
+		}
+	}
+}
+
+// execProgram runs the program with the args in dir and returns its stdout
+// (even if the program fails). Errors are formatted like the errors of a
+// `commander.ShellCommand`.
+func execProgram(dir, program string, args ...string) (string, error) {
+	cmd := exec.Command(program, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("failed to execute shell command: %v", err)
+	}
+	return string(out), nil
+}
+
+// executeDataNode records the ExecuteData that the wrapped node populates.
+type executeDataNode struct {
+	command.Node
+	ed *command.ExecuteData
+}
+
+func (n *executeDataNode) Execute(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+	n.ed = ed
+	return n.Node.Execute(i, o, d, ed)
+}
+
+func TestIntegration(t *testing.T) {
+	repo := newTestRepo(t)
+	// commandertest stubs every `commander.ShellCommand`, so the runner runs
+	// the real programs itself.
+	runner := &ShellGitRunner{
+		Dir:  repo.dir,
+		Exec: execProgram,
+	}
+	commandtest.StubValue(t, &timeNow, func() time.Time { return fakeNow })
+
+	// The CLI is reloaded from its persisted JSON before every step (like it is
+	// for every invocation of the CLI).
+	persisted := []byte("{}")
+
+	for _, step := range []struct {
+		name string
+		// setup is run in the repo before the step.
+		setup func(r *testRepo)
+		args  []string
+		// wantExecutable are the generated shell commands.
+		wantExecutable []string
+		wantStdout     string
+		wantStderr     string
+		wantErr        error
+		wantBranch     string
+		wantBranches   []string
+		// want returns the persisted CLI after the step.
+		want func(r *testRepo) *git
+	}{
+		{
+			name:           "ch -n creates a branch off of the current branch",
+			args:           []string{"ch", "-n", "feature"},
+			wantExecutable: []string{"git checkout -b feature"},
+			wantBranch:     "feature",
+			wantBranches:   []string{"feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name: "pr-link compares the branch against its parent",
+			setup: func(r *testRepo) {
+				r.commit("feature")
+			},
+			args:         []string{"pr-link"},
+			wantStdout:   "https://github.com/user/repo/compare/main...feature?expand=1\n",
+			wantBranch:   "feature",
+			wantBranches: []string{"feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:           "pb checks out the previous branch",
+			args:           []string{"pb"},
+			wantExecutable: []string{"git checkout main"},
+			wantBranch:     "main",
+			wantBranches:   []string{"feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "feature", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:           "pb goes back to the branch",
+			args:           []string{"pb"},
+			wantExecutable: []string{"git checkout feature"},
+			wantBranch:     "feature",
+			wantBranches:   []string{"feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:           "ch -n creates a branch off of a non-main parent",
+			args:           []string{"ch", "-n", "child"},
+			wantExecutable: []string{"git checkout -b child"},
+			wantBranch:     "child",
+			wantBranches:   []string{"child", "feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main", "child": "feature"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "feature", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name: "pr-link compares the child against its parent",
+			setup: func(r *testRepo) {
+				r.commit("child")
+			},
+			args:         []string{"pr-link"},
+			wantStdout:   "https://github.com/user/repo/compare/feature...child?expand=1\n",
+			wantBranch:   "child",
+			wantBranches: []string{"child", "feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main", "child": "feature"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "feature", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:           "pb checks out the parent branch",
+			args:           []string{"pb"},
+			wantExecutable: []string{"git checkout feature"},
+			wantBranch:     "feature",
+			wantBranches:   []string{"child", "feature", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"feature": "main", "child": "feature"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "child", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name: "end deletes the merged branch and restacks its child",
+			setup: func(r *testRepo) {
+				// Merge the branch into main on the remote (like a merged PR).
+				r.run("push", "origin", "feature:main")
+			},
+			args: []string{"end", "--restack"},
+			wantExecutable: []string{
+				"git checkout main && git pull && git rebase --onto main feature child && git checkout main && git branch -d feature",
+			},
+			wantStdout:   "git checkout main && git pull && git rebase --onto main feature child && git checkout main && git branch -d feature\n",
+			wantBranch:   "main",
+			wantBranches: []string{"child", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"child": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "child", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:         "tree shows the child under main",
+			args:         []string{"tree"},
+			wantStdout:   "main *\n└── child [ahead 1, behind 0]\n",
+			wantBranch:   "main",
+			wantBranches: []string{"child", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"child": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "child", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name: "restack stops on conflicts",
+			setup: func(r *testRepo) {
+				r.write("child.txt", "main")
+				r.run("add", "--", "child.txt")
+				r.run("commit", "-m", "conflict")
+			},
+			args:         []string{"restack"},
+			wantStdout:   "Auto-merging child.txt\nCONFLICT (add/add): Merge conflict in child.txt\n",
+			wantStderr:   "failed to restack child onto main; resolve the conflicts and run `g restack --continue`: failed to execute shell command: exit status 1\n",
+			wantErr:      fmt.Errorf("failed to restack child onto main; resolve the conflicts and run `g restack --continue`: failed to execute shell command: exit status 1"),
+			wantBranch:   "HEAD",
+			wantBranches: []string{"child", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"child": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "child", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+					Restacks: map[string]*Restack{
+						r.id: {Branch: "main"},
+					},
+				}
+			},
+		},
+		{
+			name: "restack continue finishes the restack",
+			setup: func(r *testRepo) {
+				r.write("child.txt", "resolved")
+				r.run("add", "--", "child.txt")
+			},
+			args: []string{"restack", "--continue"},
+			wantStdout: strings.Join([]string{
+				"[detached HEAD aa952c6] child",
+				" 1 file changed, 1 insertion(+), 1 deletion(-)",
+				"Current branch child is up to date.",
+				"Your branch is ahead of 'origin/main' by 1 commit.",
+				`  (use "git push" to publish your local commits)`,
+				"Restacked 1 branch(es) on main",
+				"",
+			}, "\n"),
+			wantBranch:   "main",
+			wantBranches: []string{"child", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"child": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "child", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:           "mv renames the branch and its metadata",
+			args:           []string{"mv", "child", "renamed"},
+			wantExecutable: []string{"git branch -m child renamed"},
+			wantBranch:     "main",
+			wantBranches:   []string{"main", "renamed"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"renamed": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "renamed", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name: "restack rebases the branch onto its updated parent",
+			setup: func(r *testRepo) {
+				r.commit("update")
+			},
+			args: []string{"restack"},
+			wantStdout: strings.Join([]string{
+				"Your branch is ahead of 'origin/main' by 2 commits.",
+				`  (use "git push" to publish your local commits)`,
+				"Restacked 1 branch(es) on main",
+				"",
+			}, "\n"),
+			wantBranch:   "main",
+			wantBranches: []string{"main", "renamed"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"renamed": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "renamed", Time: fakeNow}, {Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name:         "ch runs git directly in direct mode",
+			args:         []string{"-x", "ch", "renamed"},
+			wantBranch:   "renamed",
+			wantBranches: []string{"main", "renamed"},
+			want: func(r *testRepo) *git {
+				return &git{
+					RepoParentBranches: map[string]map[string]string{
+						r.id: {"renamed": "main"},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+		{
+			name: "cleanup deletes the merged branch and keeps the new one",
+			setup: func(r *testRepo) {
+				r.run("checkout", "main")
+				r.run("branch", "fresh")
+				r.run("merge", "--no-ff", "renamed", "-m", "Merge renamed")
+			},
+			args: []string{"cleanup"},
+			wantStdout: strings.Join([]string{
+				"Deleting branches merged into main:",
+				"  renamed (parent: main)",
+				"",
+			}, "\n"),
+			wantExecutable: []string{"git branch -D renamed"},
+			wantBranch:     "main",
+			wantBranches:   []string{"fresh", "main"},
+			want: func(r *testRepo) *git {
+				return &git{
+					BranchHistory: map[string][]*BranchVisit{
+						r.dir: {{Branch: "main", Time: fakeNow}},
+					},
+				}
+			},
+		},
+	} {
+		if !t.Run(step.name, func(t *testing.T) {
+			repo.t = t
+			if step.setup != nil {
+				step.setup(repo)
+			}
+
+			g := CLIWithRunner(runner)
+			if err := json.Unmarshal(persisted, g); err != nil {
+				t.Fatalf("json.Unmarshal(%s) returned error: %v", persisted, err)
+			}
+
+			node := &executeDataNode{Node: g.Node()}
+			etc := &commandtest.ExecuteTestCase{
+				Node: node,
+				Args: step.args,
+				Env: map[string]string{
+					"USER": "person",
+				},
+				SkipDataCheck: true,
+				WantStdout:    step.wantStdout,
+				WantStderr:    step.wantStderr,
+				WantErr:       step.wantErr,
+			}
+			if step.wantExecutable != nil {
+				etc.WantExecuteData = &command.ExecuteData{
+					Executable: step.wantExecutable,
+				}
+			}
+			commandertest.ExecuteTest(t, etc)
+			// Run the commands that were actually generated.
+			if node.ed != nil {
+				repo.execute(node.ed.Executable)
+			}
+
+			if got := repo.run("rev-parse", "--abbrev-ref", "HEAD"); got != step.wantBranch {
+				t.Errorf("checked out branch is %q; want %q", got, step.wantBranch)
+			}
+			if diff := cmp.Diff(step.wantBranches, repo.branches()); diff != "" {
+				t.Errorf("local branches returned diff (-want, +got):\n%s", diff)
+			}
+
+			b, err := json.Marshal(g)
+			if err != nil {
+				t.Fatalf("json.Marshal(%v) returned error: %v", g, err)
+			}
+			persisted = b
+			reloaded := &git{}
+			if err := json.Unmarshal(persisted, reloaded); err != nil {
+				t.Fatalf("json.Unmarshal(%s) returned error: %v", persisted, err)
+			}
+			if diff := cmp.Diff(step.want(repo), reloaded, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("persisted git returned diff (-want, +got):\n%s", diff)
+			}
+		}) {
+			break
+		}
+	}
+}
+
+func TestIntegrationParsesNULSeparatedOutput(t *testing.T) {
+	repo := newTestRepo(t)
+	runner := &ShellGitRunner{
+		Dir:  repo.dir,
+		Exec: execProgram,
+	}
+	repo.run("mv", "initial.txt", "re named.txt")
+	repo.write("new file.txt", "new")
+
+	wantStatus := []*StatusEntry{
+		{
+			Type:     RenamedEntry,
+			XY:       "R.",
+			Sub:      "N...",
+			Modes:    []string{"100644", "100644", "100644"},
+			Hashes:   []string{"c72f08c3900d3b64371fe8d74f09624e277be2c6", "c72f08c3900d3b64371fe8d74f09624e277be2c6"},
+			Score:    "R100",
+			Path:     "re named.txt",
+			OrigPath: "initial.txt",
+		},
+		{
+			Type: UntrackedEntry,
+			Path: "new file.txt",
+		},
+	}
+	status, err := runner.Status(nil, nil, "")
+	if err != nil {
+		t.Fatalf("Status() returned error: %v", err)
+	}
+	if diff := cmp.Diff(wantStatus, status, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("Status() returned diff (-want, +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want []string
+	}{
+		{},
+		{
+			args: []string{"--cached"},
+			want: []string{"initial.txt", "re named.txt"},
+		},
+	} {
+		got, err := runner.DiffNameStatus(nil, nil, test.args...)
+		if err != nil {
+			t.Fatalf("DiffNameStatus(%v) returned error: %v", test.args, err)
+		}
+		if diff := cmp.Diff(test.want, got, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("DiffNameStatus(%v) returned diff (-want, +got):\n%s", test.args, diff)
+		}
+	}
+}
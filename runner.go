@@ -0,0 +1,404 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+// GitRunner reads (and runs commands in) the git repo in the current
+// directory. Every method forwards the stderr of the underlying git command to o, which may be
+// nil to hide it.
+type GitRunner interface {
+	// CurrentBranch returns the name of the checked out branch.
+	CurrentBranch(o command.Output, d *command.Data) (string, error)
+	// Root returns the path of the repo's top-level directory.
+	Root(o command.Output, d *command.Data) (string, error)
+	// RemoteURL returns the url of the origin remote.
+	RemoteURL(o command.Output, d *command.Data) (string, error)
+	// RepoID returns the identity of the repo: its common git directory, which
+	// is shared by all of the repo's worktrees.
+	RepoID(o command.Output, d *command.Data) (string, error)
+	// RemoteHead returns the branch that the origin remote's HEAD points to, as
+	// recorded by the local `refs/remotes/origin/HEAD` ref.
+	RemoteHead(o command.Output, d *command.Data) (string, error)
+	// QueryRemoteHead asks the origin remote itself which branch its HEAD
+	// points to.
+	QueryRemoteHead(o command.Output, d *command.Data) (string, error)
+	// Branches returns the local branches of the repo in dir (or of the
+	// current directory if dir is empty).
+	Branches(o command.Output, d *command.Data, dir string) ([]*Branch, error)
+	// BranchTips returns a map from local branch name to the commit that the
+	// branch points to.
+	BranchTips(o command.Output, d *command.Data) (map[string]string, error)
+	// MergedBranches returns the local branches whose tips are reachable from
+	// base.
+	MergedBranches(o command.Output, d *command.Data, base string) ([]string, error)
+	// SquashMerged returns whether base already contains a patch equivalent to
+	// all of the branch's changes squashed together.
+	SquashMerged(o command.Output, d *command.Data, base, branch string) (bool, error)
+	// MergeBase returns the best common ancestor of the provided commits.
+	MergeBase(o command.Output, d *command.Data, a, b string) (string, error)
+	// FirstParentContains returns whether the commit is in the first-parent
+	// history of branch (the commits that were made on the branch itself rather
+	// than merged into it).
+	FirstParentContains(o command.Output, d *command.Data, branch, commit string) (bool, error)
+	// AheadBehind returns the number of commits that branch is ahead of and
+	// behind parent.
+	AheadBehind(o command.Output, d *command.Data, parent, branch string) (int, int, error)
+	// DiffNameStatus returns the (repo root relative) paths that are changed
+	// in `git diff args...`. Both the source and target paths of renames and
+	// copies are included.
+	DiffNameStatus(o command.Output, d *command.Data, args ...string) ([]string, error)
+	// Status returns the status entries of the worktree in dir (or of the
+	// current directory if dir is empty).
+	Status(o command.Output, d *command.Data, dir string) ([]*StatusEntry, error)
+	// Worktrees returns all of the repo's worktrees. The main worktree is
+	// always the first entry.
+	Worktrees(o command.Output, d *command.Data) ([]*Worktree, error)
+	// PushUpstream pushes the branch to origin and sets it as the branch's
+	// upstream.
+	PushUpstream(o command.Output, d *command.Data, branch string) error
+	// Run runs the program (git, or another executable like rm) with the args
+	// and forwards its stdout to o.
+	Run(o command.Output, d *command.Data, program string, args ...string) error
+}
+
+// Branch is a local branch.
+type Branch struct {
+	Name string
+	// Current is whether the branch is checked out in the current worktree.
+	Current bool
+	// Worktree is whether the branch is checked out in another worktree.
+	Worktree bool
+}
+
+// Worktree is an entry from `git worktree list`.
+type Worktree struct {
+	Path string
+	// Branch is the branch checked out in the worktree (empty if the worktree
+	// is in a detached HEAD state or is bare).
+	Branch string
+}
+
+// ShellGitRunner is the GitRunner that runs the git executable.
+type ShellGitRunner struct {
+	// Dir is the directory that commands are run in (the current directory if
+	// empty).
+	Dir string
+	// Exec, if set, runs the program with the args in dir and returns its
+	// stdout. Otherwise, programs are run with a `commander.ShellCommand`.
+	Exec func(dir, program string, args ...string) (string, error)
+}
+
+func (r *ShellGitRunner) run(o command.Output, d *command.Data, args ...string) (string, error) {
+	if r.Exec != nil {
+		out, err := r.Exec(r.Dir, "git", args...)
+		return strings.TrimSuffix(out, "\n"), err
+	}
+	sc := &commander.ShellCommand[string]{
+		CommandName: "git",
+		Args:        args,
+		Dir:         r.Dir,
+		HideStderr:  o == nil,
+	}
+	return sc.Run(o, d)
+}
+
+func (r *ShellGitRunner) runLines(o command.Output, d *command.Data, args ...string) ([]string, error) {
+	if r.Exec != nil {
+		out, err := r.run(o, d, args...)
+		if err != nil || out == "" {
+			return nil, err
+		}
+		return strings.Split(out, "\n"), nil
+	}
+	sc := &commander.ShellCommand[[]string]{
+		CommandName: "git",
+		Args:        args,
+		Dir:         r.Dir,
+		HideStderr:  o == nil,
+	}
+	return sc.Run(o, d)
+}
+
+func (r *ShellGitRunner) Run(o command.Output, d *command.Data, program string, args ...string) error {
+	if r.Exec != nil {
+		out, err := r.Exec(r.Dir, program, args...)
+		o.Stdout(out)
+		return err
+	}
+	sc := &commander.ShellCommand[string]{
+		CommandName:   program,
+		Args:          args,
+		Dir:           r.Dir,
+		ForwardStdout: true,
+	}
+	_, err := sc.Run(o, d)
+	return err
+}
+
+func (r *ShellGitRunner) CurrentBranch(o command.Output, d *command.Data) (string, error) {
+	return r.run(o, d, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+func (r *ShellGitRunner) Root(o command.Output, d *command.Data) (string, error) {
+	return r.run(o, d, "rev-parse", "--show-toplevel")
+}
+
+func (r *ShellGitRunner) RemoteURL(o command.Output, d *command.Data) (string, error) {
+	return r.run(o, d, "config", "--get", "remote.origin.url")
+}
+
+func (r *ShellGitRunner) RepoID(o command.Output, d *command.Data) (string, error) {
+	return r.run(o, d, "rev-parse", "--path-format=absolute", "--git-common-dir")
+}
+
+func (r *ShellGitRunner) RemoteHead(o command.Output, d *command.Data) (string, error) {
+	head, err := r.run(o, d, "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(head), "origin/"), nil
+}
+
+func (r *ShellGitRunner) QueryRemoteHead(o command.Output, d *command.Data) (string, error) {
+	lines, err := r.runLines(o, d, "ls-remote", "--symref", "origin", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	// The symref line looks like `ref: refs/heads/main<TAB>HEAD`
+	for _, line := range lines {
+		if ref, ok := strings.CutPrefix(line, "ref: "); ok {
+			ref, _, _ = strings.Cut(ref, "\t")
+			return strings.TrimPrefix(strings.TrimSpace(ref), "refs/heads/"), nil
+		}
+	}
+	return "", fmt.Errorf("no HEAD symref for remote origin")
+}
+
+func (r *ShellGitRunner) Branches(o command.Output, d *command.Data, dir string) ([]*Branch, error) {
+	var args []string
+	if dir != "" {
+		args = append(args, "-C", dir)
+	}
+	lines, err := r.runLines(o, d, append(args, "branch", "--list")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBranches(lines), nil
+}
+
+func (r *ShellGitRunner) BranchTips(o command.Output, d *command.Data) (map[string]string, error) {
+	lines, err := r.runLines(o, d, "for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	tips := map[string]string{}
+	for _, line := range lines {
+		if b, commit, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			tips[b] = commit
+		}
+	}
+	return tips, nil
+}
+
+func (r *ShellGitRunner) MergedBranches(o command.Output, d *command.Data, base string) ([]string, error) {
+	lines, err := r.runLines(o, d, "branch", "--merged", base, "--format=%(refname:short)")
+	if err != nil {
+		return nil, err
+	}
+	var merged []string
+	for _, b := range lines {
+		if b = strings.TrimSpace(b); b != "" {
+			merged = append(merged, b)
+		}
+	}
+	return merged, nil
+}
+
+// SquashMerged squashes the branch into a single (dangling) commit and checks
+// if base already contains an equivalent patch.
+func (r *ShellGitRunner) SquashMerged(o command.Output, d *command.Data, base, branch string) (bool, error) {
+	mergeBase, err := r.run(o, d, "merge-base", base, branch)
+	if err != nil {
+		return false, fmt.Errorf("failed to get merge base for %s: %v", branch, err)
+	}
+	squashCommit, err := r.run(o, d, "commit-tree", fmt.Sprintf("%s^{tree}", branch), "-p", mergeBase, "-m", fmt.Sprintf("Squash of %s", branch))
+	if err != nil {
+		return false, fmt.Errorf("failed to create squash commit for %s: %v", branch, err)
+	}
+	cherry, err := r.run(o, d, "cherry", base, squashCommit)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare %s to %s: %v", branch, base, err)
+	}
+	return strings.HasPrefix(cherry, "-"), nil
+}
+
+func (r *ShellGitRunner) MergeBase(o command.Output, d *command.Data, a, b string) (string, error) {
+	mb, err := r.run(o, d, "merge-base", a, b)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(mb), nil
+}
+
+// FirstParentContains walks the first parents of branch back to the commit. The
+// commit is in the first-parent history if the walk ends right at it.
+func (r *ShellGitRunner) FirstParentContains(o command.Output, d *command.Data, branch, commit string) (bool, error) {
+	lines, err := r.runLines(o, d, "rev-list", "--first-parent", "--parents", fmt.Sprintf("%s..%s", commit, branch))
+	if err != nil {
+		return false, err
+	}
+	var last string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			last = line
+		}
+	}
+	if last == "" {
+		// Every commit of branch is reachable from the commit.
+		return true, nil
+	}
+	// Each line is a commit followed by its parents.
+	parents := strings.Fields(last)[1:]
+	return len(parents) > 0 && parents[0] == commit, nil
+}
+
+func (r *ShellGitRunner) AheadBehind(o command.Output, d *command.Data, parent, branch string) (int, int, error) {
+	out, err := r.run(o, d, "rev-list", "--left-right", "--count", fmt.Sprintf("%s...%s", parent, branch))
+	if err != nil {
+		return 0, 0, err
+	}
+	var behind, ahead int
+	if _, err := fmt.Sscanf(out, "%d %d", &behind, &ahead); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse rev-list output (%q): %v", out, err)
+	}
+	return ahead, behind, nil
+}
+
+func (r *ShellGitRunner) DiffNameStatus(o command.Output, d *command.Data, args ...string) ([]string, error) {
+	out, err := r.run(o, d, append([]string{"diff", "--name-status", "-z"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseNameStatus(out)
+}
+
+func (r *ShellGitRunner) Status(o command.Output, d *command.Data, dir string) ([]*StatusEntry, error) {
+	var args []string
+	if dir != "" {
+		args = append(args, "-C", dir)
+	}
+	out, err := r.run(o, d, append(args,
+		"status",
+		// Note: this requires that `git config status.relativePaths true`
+		"--porcelain=v2",
+		"-z",
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStatus(out)
+}
+
+func (r *ShellGitRunner) Worktrees(o command.Output, d *command.Data) ([]*Worktree, error) {
+	lines, err := r.runLines(o, d, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	var wts []*Worktree
+	for _, line := range lines {
+		if path, ok := strings.CutPrefix(line, "worktree "); ok {
+			wts = append(wts, &Worktree{Path: path})
+			continue
+		}
+		if ref, ok := strings.CutPrefix(line, "branch "); ok && len(wts) > 0 {
+			wts[len(wts)-1].Branch = strings.TrimPrefix(ref, "refs/heads/")
+		}
+	}
+	return wts, nil
+}
+
+func (r *ShellGitRunner) PushUpstream(o command.Output, d *command.Data, branch string) error {
+	_, err := r.run(o, d, "push", "--set-upstream", "origin", branch)
+	return err
+}
+
+// parseBranches parses the output lines of `git branch --list`.
+func parseBranches(lines []string) []*Branch {
+	var r []*Branch
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		b := &Branch{}
+		if name, ok := strings.CutPrefix(line, "* "); ok {
+			b.Current = true
+			line = name
+		} else if name, ok := strings.CutPrefix(line, "+ "); ok {
+			// Branches that are checked out in other worktrees are marked with a `+`.
+			b.Worktree = true
+			line = name
+		}
+		b.Name = strings.TrimSpace(line)
+		r = append(r, b)
+	}
+	return r
+}
+
+// gitArg is a value that is read with a GitRunner and stored in the data (like
+// a `commander.ShellCommand` arg).
+type gitArg[T any] struct {
+	ArgName       string
+	runOnComplete bool
+	get           func(r GitRunner, o command.Output, d *command.Data) (T, error)
+}
+
+// newGitArg returns a gitArg for the value returned by get. The value is only
+// fetched during completion if runOnComplete is set.
+func newGitArg[T any](argName string, runOnComplete bool, get func(r GitRunner, o command.Output, d *command.Data) (T, error)) *gitArg[T] {
+	return &gitArg[T]{
+		ArgName:       argName,
+		runOnComplete: runOnComplete,
+		get:           get,
+	}
+}
+
+// processor returns a processor that reads the value with r and stores it in
+// the data.
+func (ga *gitArg[T]) processor(r GitRunner) command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+		v, err := ga.get(r, o, d)
+		if err != nil {
+			return o.Err(err)
+		}
+		d.Set(ga.ArgName, v)
+		return nil
+	}, func(i *command.Input, d *command.Data) (*command.Completion, error) {
+		if !ga.runOnComplete {
+			return nil, nil
+		}
+		v, err := ga.get(r, nil, d)
+		if err != nil {
+			return nil, err
+		}
+		d.Set(ga.ArgName, v)
+		return nil, nil
+	})
+}
+
+// Name returns the key that the value is stored under in the data.
+func (ga *gitArg[T]) Name() string {
+	return ga.ArgName
+}
+
+// Get returns the value that was stored in the data.
+func (ga *gitArg[T]) Get(d *command.Data) T {
+	v, _ := d.Get(ga.ArgName).(T)
+	return v
+}
@@ -0,0 +1,417 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commandertest"
+	"github.com/leep-frog/command/commandtest"
+)
+
+func TestParseBranches(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		lines []string
+		want  []*Branch
+	}{
+		{
+			name: "no branches",
+		},
+		{
+			name:  "parses branches",
+			lines: []string{"  b-1 ", "* \tb-2", "+ in-worktree", "\t\tb-3\t\t", ""},
+			want: []*Branch{
+				{Name: "b-1"},
+				{Name: "b-2", Current: true},
+				{Name: "in-worktree", Worktree: true},
+				{Name: "b-3"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, parseBranches(test.lines)); diff != "" {
+				t.Errorf("parseBranches(%q) returned diff (-want, +got):\n%s", test.lines, diff)
+			}
+		})
+	}
+}
+
+func TestFakeGitRunner(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		runner     *FakeGitRunner
+		g          *git
+		want       *git
+		wantPushed []string
+		etc        *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "outputs the current branch",
+			runner: &FakeGitRunner{
+				Branch: "some-branch",
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"current"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					formatFlag.Name(): "%s\n",
+				}},
+				WantStdout: "some-branch\n",
+			},
+		},
+		{
+			name:   "current branch fails if no branch",
+			runner: &FakeGitRunner{},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"current"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					formatFlag.Name(): "%s\n",
+				}},
+				WantStderr: "no branch is checked out\n",
+				WantErr:    fmt.Errorf("no branch is checked out"),
+			},
+		},
+		{
+			name: "checks out the previous branch",
+			runner: &FakeGitRunner{
+				Branch:  "current-branch",
+				RootDir: "/some/git/root",
+			},
+			g: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/some/git/root": {{Branch: "old-branch"}},
+				},
+			},
+			want: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/some/git/root": {{Branch: "current-branch", Time: fakeNow}},
+				},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"pb"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					gitRootDir.ArgName:       "/some/git/root",
+					currentBranchArg.ArgName: "current-branch",
+					pbArg.Name():             1,
+				}},
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"git checkout old-branch"},
+				},
+			},
+		},
+		{
+			name: "previous branch fails outside of a repo",
+			runner: &FakeGitRunner{
+				Branch: "current-branch",
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"pb"},
+				WantStderr: "not a git repository\n",
+				WantErr:    fmt.Errorf("not a git repository"),
+			},
+		},
+		{
+			name: "sets the default branch for the remote",
+			runner: &FakeGitRunner{
+				URL: "git@github.com:user/repo.git",
+			},
+			want: &git{
+				MainBranches: map[string]string{
+					"git@github.com:user/repo.git": "trunk",
+				},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "main", "set", "trunk"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					repoUrl.Name():    "git@github.com:user/repo.git",
+					defRepoArg.Name(): "trunk",
+				}},
+				WantStdout: "Setting default branch for git@github.com:user/repo.git to trunk\n",
+			},
+		},
+		{
+			name: "pushes upstream and outputs the PR link",
+			runner: &FakeGitRunner{
+				Branch: "some-branch",
+				URL:    "git@github.com:user/some-repo.git",
+				ID:     fakeRepoID,
+			},
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"some-branch": "parent-branch",
+					},
+				},
+			},
+			wantPushed: []string{"some-branch"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"up"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					currentBranchArg.ArgName: "some-branch",
+					repoUrl.ArgName:          "git@github.com:user/some-repo.git",
+				}},
+				WantStdout: "https://github.com/user/some-repo/compare/parent-branch...some-branch?expand=1\n",
+			},
+		},
+		{
+			name: "outputs the tree with ahead and behind counts",
+			runner: &FakeGitRunner{
+				Branch:        "a",
+				ID:            fakeRepoID,
+				LocalBranches: []string{"a", "main"},
+				Counts: map[[2]string][2]int{
+					{"main", "a"}: {2, 1},
+				},
+			},
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {"a": "main"},
+				},
+			},
+			want: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {"a": "main"},
+				},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"tree"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					currentBranchArg.ArgName: "a",
+				}},
+				WantStdout: "main\n└── a * [ahead 2, behind 1]\n",
+			},
+		},
+		{
+			name: "cleans up merged and squash-merged branches",
+			runner: &FakeGitRunner{
+				Branch:        "main",
+				URL:           "git@github.com:user/repo.git",
+				ID:            fakeRepoID,
+				Head:          "main",
+				LocalBranches: []string{"checked-out", "fresh", "main", "merged", "open", "squashed"},
+				WorktreeList: []*Worktree{
+					{Path: "/repo", Branch: "main"},
+					{Path: "/repo-wt", Branch: "checked-out"},
+				},
+				Tips: map[string]string{
+					"checked-out": "c1",
+					"fresh":       "m0",
+					"main":        "m1",
+					"merged":      "a1",
+					"open":        "o1",
+					"squashed":    "s1",
+				},
+				Merged: map[string][]string{
+					"main": {"checked-out", "fresh", "main", "merged"},
+				},
+				MergeBases: map[[2]string]string{
+					{"main", "fresh"}:    "m0",
+					{"main", "merged"}:   "a1",
+					{"main", "squashed"}: "b1",
+				},
+				FirstParents: map[string][]string{
+					"main": {"m1", "m0"},
+				},
+				Squashed: map[string][]string{
+					"main": {"squashed"},
+				},
+			},
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {"open": "main"},
+				},
+			},
+			want: &git{
+				MainBranches: map[string]string{
+					"git@github.com:user/repo.git": "main",
+				},
+				DetectedMainBranches: map[string]bool{
+					"git@github.com:user/repo.git": true,
+				},
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {"open": "main"},
+				},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cleanup"},
+				WantData: &command.Data{Values: map[string]interface{}{
+					repoUrl.ArgName: "git@github.com:user/repo.git",
+				}},
+				WantStdout: strings.Join([]string{
+					"Deleting branches merged into main:",
+					"  merged",
+					"  squashed (squash-merged)",
+					"",
+				}, "\n"),
+				WantExecuteData: &command.ExecuteData{
+					Executable: []string{"git branch -D merged squashed"},
+				},
+			},
+		},
+		{
+			name: "runner errors are returned",
+			runner: &FakeGitRunner{
+				Err: fmt.Errorf("oops"),
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args:       []string{"cfg", "main", "set", "trunk"},
+				WantStderr: "oops\n",
+				WantErr:    fmt.Errorf("oops"),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.etc.Env = map[string]string{
+				"USER": "person",
+			}
+			commandtest.StubValue(t, &timeNow, func() time.Time { return fakeNow })
+
+			if test.g == nil {
+				test.g = CLI()
+			}
+			test.g.runner = test.runner
+			test.etc.Node = test.g.Node()
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.g, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty())
+			if diff := cmp.Diff(test.wantPushed, test.runner.Pushed); diff != "" {
+				t.Errorf("FakeGitRunner.Pushed returned diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFakeGitRunnerAutocomplete(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		runner *FakeGitRunner
+		getwd  string
+		ctc    *commandtest.CompleteTestCase
+	}{
+		{
+			name: "completes branches",
+			runner: &FakeGitRunner{
+				Branch:        "current",
+				LocalBranches: []string{"current", "other", "person/mine"},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd bd ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"mine", "other", "person/mine"},
+				},
+			},
+		},
+		{
+			name: "completes files to add",
+			runner: &FakeGitRunner{
+				Statuses: map[string][]*StatusEntry{
+					"": {
+						{Type: OrdinaryEntry, XY: ".M", Path: "modified.go"},
+						{Type: OrdinaryEntry, XY: "M.", Path: "staged.go"},
+						{Type: UntrackedEntry, Path: "untracked.go"},
+					},
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd a ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"modified.go", "untracked.go"},
+				},
+			},
+		},
+		{
+			name:  "completes diff files",
+			getwd: filepath.Join("/", "git", "root", "sub"),
+			runner: &FakeGitRunner{
+				RootDir: filepath.Join("/", "git", "root"),
+				Diffs: map[string][]string{
+					"":         {"sub/a.go", "b.go"},
+					"--cached": {"b.go"},
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{filepath.Join("..", "b.go"), "a.go"},
+				},
+			},
+		},
+		{
+			name: "completion fails if runner fails",
+			runner: &FakeGitRunner{
+				Err: fmt.Errorf("oops"),
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd bd ",
+				SkipDataCheck: true,
+				WantErr:       fmt.Errorf("failed to get git branches: oops"),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.getwd != "" {
+				commandtest.StubGetwd(t, test.getwd, nil)
+			}
+			test.ctc.Env = map[string]string{
+				"USER": "person",
+			}
+			test.ctc.Node = CLIWithRunner(test.runner).Node()
+			commandertest.AutocompleteTest(t, test.ctc)
+		})
+	}
+}
+
+func TestRecentBranchCompleter(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		history map[string][]*BranchVisit
+		want    []string
+	}{
+		{
+			name: "orders branches alphabetically without history",
+			history: map[string][]*BranchVisit{
+				"/other/repo": {{Branch: "z-recent"}},
+			},
+			want: []string{"a-older", "b-unvisited", "mine", "person/mine", "z-recent"},
+		},
+		{
+			name: "orders recent branches first",
+			history: map[string][]*BranchVisit{
+				"/repo": {
+					{Branch: "z-recent"},
+					{Branch: "person/mine"},
+					{Branch: "a-older"},
+					{Branch: "z-recent"},
+					{Branch: "deleted"},
+				},
+			},
+			want: []string{"z-recent", "mine", "person/mine", "a-older", "b-unvisited"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			g := CLIWithRunner(&FakeGitRunner{
+				Branch:        "current",
+				RootDir:       "/repo",
+				LocalBranches: []string{"a-older", "b-unvisited", "current", "person/mine", "z-recent"},
+			})
+			g.BranchHistory = test.history
+			d := &command.Data{Values: map[string]interface{}{
+				userArg.Name: "person",
+			}}
+			c, err := g.recentBranchCompleter().Complete("", d)
+			if err != nil {
+				t.Fatalf("recentBranchCompleter().Complete() returned error: %v", err)
+			}
+			if diff := cmp.Diff(test.want, c.Suggestions); diff != "" {
+				t.Errorf("recentBranchCompleter().Complete() returned diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/sourcerer"
+)
+
+// shellFamily is the strategy for generating commands for the shell used by a
+// family of operating systems.
+type shellFamily struct {
+	// join converts the commands into executable lines that stop at the first
+	// failing command.
+	join func(cmds []string) []string
+	// quote returns the string as a single shell word that the shell passes
+	// through to the command as is.
+	quote func(s string) string
+}
+
+var (
+	posixShell = &shellFamily{
+		join: func(cmds []string) []string {
+			return []string{strings.Join(cmds, " && ")}
+		},
+		quote: posixQuote,
+	}
+	powerShell = &shellFamily{
+		join: func(cmds []string) []string {
+			var wr []string
+			for _, c := range cmds {
+				wr = append(wr, wCmd(c))
+			}
+			return wr
+		},
+		quote: powerShellQuote,
+	}
+)
+
+// shellFor returns the shell family for the OS with the provided name (as
+// returned by `sourcerer.CurrentOS.Name()`). Every OS other than Windows
+// (Linux, macOS, the BSDs, etc.) uses a POSIX shell.
+func shellFor(osName string) *shellFamily {
+	if osName == "windows" {
+		return powerShell
+	}
+	return posixShell
+}
+
+// currentShell returns the shell family for the current OS.
+func currentShell() *shellFamily {
+	return shellFor(sourcerer.CurrentOS.Name())
+}
+
+func joinByOS(cmds ...string) []string {
+	return currentShell().join(cmds)
+}
+
+// shellQuote quotes each of the args for the current OS's shell and joins them
+// with spaces. Every user-provided value (file names, branch names, commit
+// messages, etc.) must go through this before being put in a generated
+// command. Note that quoting doesn't stop git from treating an arg with a
+// leading dash as an option, so pathspecs should also come after a `--` arg.
+func shellQuote(args ...string) string {
+	sh := currentShell()
+	var r []string
+	for _, a := range args {
+		r = append(r, sh.quote(a))
+	}
+	return strings.Join(r, " ")
+}
+
+// onlyContains returns whether s is non-empty and only contains ASCII letters,
+// digits, and characters in special.
+func onlyContains(s, special string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c < 0x80 && strings.ContainsRune(special, c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// posixQuote quotes the string for bash (and other POSIX shells). Nothing is
+// special inside single quotes, so the only thing to handle is single quotes
+// themselves, which are replaced with a closing quote, an escaped quote, and an
+// opening quote.
+func posixQuote(s string) string {
+	// A tilde is only expanded at the start of a word or after an `=` or `:`.
+	if onlyContains(s, "@%+=:,./_-~") && !strings.HasPrefix(s, "~") && !strings.Contains(s, "=~") && !strings.Contains(s, ":~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// powerShellSingleQuotes are the characters that PowerShell treats as a single
+// quote (it accepts curly quotes as well).
+var powerShellSingleQuotes = []string{"'", "‘", "’", "‚", "‛"}
+
+// powerShellQuote quotes the string for PowerShell.
+func powerShellQuote(s string) string {
+	if onlyContains(s, `./:=+\_-~`) && !strings.HasPrefix(s, "~") {
+		return s
+	}
+	return powerShellLiteral(s)
+}
+
+// powerShellLiteral returns the string as a PowerShell verbatim (single-quoted)
+// string. Nothing is special in a verbatim string except for the quote
+// characters, which are escaped by doubling them.
+func powerShellLiteral(s string) string {
+	for _, q := range powerShellSingleQuotes {
+		s = strings.ReplaceAll(s, q, q+q)
+	}
+	return "'" + s + "'"
+}
+
+func wCmd(s string) string {
+	return strings.Join([]string{
+		s,
+		fmt.Sprintf("if (!$?) { throw %s }", powerShellLiteral(fmt.Sprintf("Command failed: %s", s))),
+	}, "\n")
+}
@@ -0,0 +1,281 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/leep-frog/command/commandtest"
+	"github.com/leep-frog/command/sourcerer"
+)
+
+// adversarialNames are file names (and other user input) that break naively
+// generated commands.
+var adversarialNames = []string{
+	"",
+	"simple.go",
+	"dir/file.go",
+	"with space.go",
+	"  leading and trailing  ",
+	"-rf",
+	"--",
+	"--%",
+	"$HOME",
+	"${HOME}",
+	"$(touch pwned)",
+	"`touch pwned`",
+	"'",
+	"it's",
+	"''",
+	`"`,
+	`say "hi"`,
+	`back\slash`,
+	`trailing\`,
+	"semi;colon",
+	"a && b",
+	"a | b",
+	"a > b",
+	"#comment",
+	"~",
+	"~user/file",
+	"HEAD~1",
+	"a=~/file",
+	"PATH=a:~/bin",
+	"*.go",
+	"[abc]",
+	"{a,b}",
+	"!event",
+	"@splat",
+	"a,b",
+	"%PATH%",
+	"new\nline",
+	"tab\there",
+	"carriage\rreturn",
+	"‘curly’",
+	"‚low‛",
+	"“double”",
+	"–en-dash",
+	"ünïcode.go",
+	"日本語",
+	"\xff\xfe invalid utf8",
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		args           []string
+		wantPOSIX      string
+		wantPowerShell string
+	}{
+		{
+			name: "no args",
+		},
+		{
+			name:           "safe args aren't quoted",
+			args:           []string{"abc", "dir/file.go", "-rf", "--", "a=b", "c:d", "x_y-z.1"},
+			wantPOSIX:      "abc dir/file.go -rf -- a=b c:d x_y-z.1",
+			wantPowerShell: "abc dir/file.go -rf -- a=b c:d x_y-z.1",
+		},
+		{
+			name:           "tildes",
+			args:           []string{"HEAD~1", "~", "~/file", "a=~", "b:~", "@~1"},
+			wantPOSIX:      "HEAD~1 '~' '~/file' 'a=~' 'b:~' @~1",
+			wantPowerShell: "HEAD~1 '~' '~/file' a=~ b:~ '@~1'",
+		},
+		{
+			name:           "empty arg",
+			args:           []string{""},
+			wantPOSIX:      "''",
+			wantPowerShell: "''",
+		},
+		{
+			name:           "spaces and variables",
+			args:           []string{"with space.go", "$HOME", "$(whoami)", "`whoami`"},
+			wantPOSIX:      "'with space.go' '$HOME' '$(whoami)' '`whoami`'",
+			wantPowerShell: "'with space.go' '$HOME' '$(whoami)' '`whoami`'",
+		},
+		{
+			name:           "single quotes",
+			args:           []string{"it's"},
+			wantPOSIX:      `'it'\''s'`,
+			wantPowerShell: `'it''s'`,
+		},
+		{
+			name:           "curly quotes",
+			args:           []string{"‘curly’"},
+			wantPOSIX:      "'‘curly’'",
+			wantPowerShell: "'‘‘curly’’'",
+		},
+		{
+			name:           "shell specific characters",
+			args:           []string{"@splat", "a,b", "%PATH%", `back\slash`},
+			wantPOSIX:      `@splat a,b %PATH% 'back\slash'`,
+			wantPowerShell: `'@splat' 'a,b' '%PATH%' back\slash`,
+		},
+		{
+			name:           "newlines",
+			args:           []string{"new\nline"},
+			wantPOSIX:      "'new\nline'",
+			wantPowerShell: "'new\nline'",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, tos := range []struct {
+				os   sourcerer.OS
+				want string
+			}{
+				{sourcerer.Linux(), test.wantPOSIX},
+				{(&fakeOS{sourcerer.Linux(), "darwin"}).os(), test.wantPOSIX},
+				{sourcerer.Windows(), test.wantPowerShell},
+				// Every OS other than Windows uses POSIX quoting.
+				{(&fakeOS{sourcerer.Linux(), "other"}).os(), test.wantPOSIX},
+			} {
+				commandtest.StubValue(t, &sourcerer.CurrentOS, tos.os)
+				if diff := cmp.Diff(tos.want, shellQuote(test.args...)); diff != "" {
+					t.Errorf("[%s] shellQuote(%q) returned diff (-want, +got):\n%s", tos.os.Name(), test.args, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestWCmd(t *testing.T) {
+	want := strings.Join([]string{
+		`git commit -m 'it''s "done"'`,
+		`if (!$?) { throw 'Command failed: git commit -m ''it''''s "done"''' }`,
+	}, "\n")
+	if diff := cmp.Diff(want, wCmd(`git commit -m 'it''s "done"'`)); diff != "" {
+		t.Errorf("wCmd() returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+// runPOSIX runs `printf` with the provided (already quoted) args in sh and
+// returns the args that it received.
+func runPOSIX(t *testing.T, quotedArgs string) []string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available on windows")
+	}
+	out, err := exec.Command("sh", "-c", fmt.Sprintf(`printf '%%s\0' %s`, quotedArgs)).Output()
+	if err != nil {
+		t.Fatalf("failed to run sh with %q: %v", quotedArgs, err)
+	}
+	return strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+}
+
+func FuzzPOSIXQuote(f *testing.F) {
+	for _, n := range adversarialNames {
+		f.Add(n)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.Contains(s, "\x00") {
+			t.Skip("args can't contain NUL characters")
+		}
+		got := runPOSIX(t, posixQuote(s))
+		if diff := cmp.Diff([]string{s}, got); diff != "" {
+			t.Errorf("sh parsed posixQuote(%q) = %q incorrectly (-want, +got):\n%s", s, posixQuote(s), diff)
+		}
+	})
+}
+
+func FuzzShellQuote(f *testing.F) {
+	for _, n := range adversarialNames {
+		f.Add(n, "-- "+n)
+	}
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if strings.Contains(a+b, "\x00") {
+			t.Skip("args can't contain NUL characters")
+		}
+		commandtest.StubValue(t, &sourcerer.CurrentOS, sourcerer.Linux())
+		got := runPOSIX(t, shellQuote(a, b))
+		if diff := cmp.Diff([]string{a, b}, got); diff != "" {
+			t.Errorf("sh parsed shellQuote(%q, %q) = %q incorrectly (-want, +got):\n%s", a, b, shellQuote(a, b), diff)
+		}
+	})
+}
+
+// parsePowerShellWord parses a single argument-mode word that is either a bare
+// word or a verbatim (single-quoted) string, and returns the string that
+// PowerShell would pass to the command.
+func parsePowerShellWord(w string) (string, error) {
+	if !strings.HasPrefix(w, "'") {
+		if strings.HasPrefix(w, "~") {
+			return "", fmt.Errorf("bare word %q starts with a tilde", w)
+		}
+		for _, c := range w {
+			if !strings.ContainsRune(`./:=+\_-~`, c) && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+				return "", fmt.Errorf("bare word %q contains special character %q", w, c)
+			}
+		}
+		return w, nil
+	}
+
+	isQuote := func(s string) (int, bool) {
+		for _, q := range powerShellSingleQuotes {
+			if strings.HasPrefix(s, q) {
+				return len(q), true
+			}
+		}
+		return 0, false
+	}
+
+	var sb strings.Builder
+	rest := w[1:]
+	for {
+		if rest == "" {
+			return "", fmt.Errorf("unterminated string %q", w)
+		}
+		if n, ok := isQuote(rest); ok {
+			m, ok := isQuote(rest[n:])
+			if !ok {
+				if rest[n:] != "" {
+					return "", fmt.Errorf("string %q ends before the end of the word", w)
+				}
+				return sb.String(), nil
+			}
+			// A doubled quote is an escaped quote (the second quote is kept).
+			sb.WriteString(rest[n : n+m])
+			rest = rest[n+m:]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		sb.WriteString(rest[:size])
+		rest = rest[size:]
+	}
+}
+
+func FuzzPowerShellQuote(f *testing.F) {
+	for _, n := range adversarialNames {
+		f.Add(n)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		q := powerShellQuote(s)
+		got, err := parsePowerShellWord(q)
+		if err != nil {
+			t.Fatalf("powerShellQuote(%q) = %q is invalid: %v", s, q, err)
+		}
+		if got != s {
+			t.Errorf("powerShellQuote(%q) = %q parsed as %q", s, q, got)
+		}
+
+		pwsh, err := exec.LookPath("pwsh")
+		if err != nil {
+			return
+		}
+		// pwsh can't receive these as part of the -Command arg.
+		if strings.ContainsAny(s, "\x00") || !utf8.ValidString(s) {
+			return
+		}
+		out, err := exec.Command(pwsh, "-NoProfile", "-NonInteractive", "-Command", fmt.Sprintf("[Console]::Out.Write(%s)", powerShellLiteral(s))).Output()
+		if err != nil {
+			t.Fatalf("failed to run pwsh with %q: %v", q, err)
+		}
+		if diff := cmp.Diff(s, string(out)); diff != "" {
+			t.Errorf("pwsh parsed powerShellLiteral(%q) incorrectly (-want, +got):\n%s", s, diff)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package sourcecontrol
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
@@ -15,26 +17,10 @@ import (
 
 const DefaultDefaultBranch = "main"
 
-func joinByOS(cmds ...string) ([]string, error) {
-	switch sourcerer.CurrentOS.Name() {
-	case "linux":
-		return []string{strings.Join(cmds, " && ")}, nil
-	case "windows":
-		var wr []string
-		for _, c := range cmds {
-			wr = append(wr, wCmd(c))
-		}
-		return wr, nil
-	}
-	return nil, fmt.Errorf("Unknown OS (%q)", sourcerer.CurrentOS.Name())
-}
-
-func executableJoinByOS(cmds ...string) command.Processor {
-	return commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-		s, err := joinByOS(cmds...)
-		return s, o.Err(err)
-	})
-}
+var (
+	// Stubbed in tests
+	osStat = os.Stat
+)
 
 const (
 	// See https://github.com/leep-frog/ssh
@@ -42,21 +28,13 @@ const (
 	createSSHAgentCommand = ""
 )
 
-func wCmd(s string) string {
-	return strings.Join([]string{
-		s,
-		// Windows escapes quotes with backtick, hence why '%q' alone isn't sufficient here
-		fmt.Sprintf("if (!$?) { throw %q }", fmt.Sprintf("Command failed: %s", strings.ReplaceAll(s, `"`, "'"))),
-	}, "\n")
-}
-
 var (
 	dryRunFlag = commander.BoolFlag("dry-run", 'y', "Dry-run mode")
 	sshNode    = commander.SerialNodes(
 		commander.FunctionWrap(),
 		commander.SimpleExecutableProcessor(createSSHAgentCommand),
 	)
-	nvFlag           = commander.BoolValueFlag("no-verify", 'n', "Whether or not to run pre-commit checks", "--no-verify ")
+	nvFlag           = commander.BoolValueFlag("no-verify", 'n', "Whether or not to run pre-commit checks", "--no-verify")
 	formatFlag       = commander.Flag("format", 'f', "Golang format for the branch", commander.Default("%s\n"))
 	parentFormatFlag = commander.Flag[string]("parent-format", 'F', "Golang format for the the parent branches")
 	prefixFlag       = commander.Flag[string]("prefix", 'p', "Prefix to include if a branch is detected")
@@ -67,106 +45,157 @@ var (
 	userArg          = &commander.EnvArg{
 		Name: "USER",
 	}
-	branchArg = commander.Arg(
-		"BRANCH",
-		"Branch",
-		BranchCompleter(),
-		&commander.Transformer[string]{func(s string, d *command.Data) (string, error) {
-			sc := &commander.ShellCommand[[]string]{
-				CommandName:   "git",
-				Args:          []string{"branch", "--list"},
-				HideStderr:    true,
-				ForwardStdout: false,
-			}
+	mainFlag         = commander.BoolFlag("main", 'm', "Whether to diff against main branch or just local diffs")
+	prevCommitFlag   = commander.BoolFlag("commit", 'c', "Whether to diff against the previous commit")
+	diffParentFlag   = commander.BoolFlag("parent", 'P', "Whether to diff against the merge-base with the current branch's parent branch")
+	diffStatFlag     = commander.BoolValueFlag("stat", 's', "Whether to only show the diffstat", "--stat")
+	diffNameOnlyFlag = commander.BoolValueFlag("name-only", 'n', "Whether to only show the names of changed files", "--name-only")
 
-			bs, err := sc.Run(nil, d)
-			if err != nil {
-				return "", fmt.Errorf("failed to get git branches: %v", err)
-			}
+	mmFetchFlag  = commander.BoolFlag("fetch", 'f', "Fetch the branch from origin first and merge origin/<branch>")
+	mmRebaseFlag = commander.BoolFlag("rebase", 'r', "Rebase onto the branch instead of merging it")
+	mmParentFlag = commander.BoolFlag("parent", 'p', "Merge the current branch's parent branch instead of the default branch")
 
-			// First check for an exact branch match, before adding the prefix.
-			// This accounts for instances where the branches `person/abc` and `abc` exist.
-			for _, b := range bs {
-				b = strings.TrimSpace(b)
-				if s == b {
-					return s, nil
-				}
-			}
+	addFlag = commander.BoolFlag("add", 'a', "If set, then files will be added")
 
-			// Then check if the branch with the user prefix exists
-			for _, b := range bs {
-				b = strings.TrimSpace(b)
-				withUser := fmt.Sprintf("%s/%s", userArg.Get(d), s)
-				if withUser == b {
-					return withUser, nil
-				}
-			}
+	gitRootDir = newGitArg("GIT_ROOT", false, GitRunner.Root)
 
-			// Otherwise, just return the branch name the user provided
-			return s, nil
-		}},
-	)
-	branchesArg = commander.ListArg(
-		"BRANCH",
-		"Branch",
-		1,
-		command.UnboundedList,
-		BranchesCompleter(),
-	)
-	mainFlag       = commander.BoolFlag("main", 'm', "Whether to diff against main branch or just local diffs")
-	prevCommitFlag = commander.BoolFlag("commit", 'c', "Whether to diff against the previous commit")
+	greenFileCompleterNoDeletes = commander.ShellCommandCompleterWithOpts[[]string](&command.Completion{Distinct: true, CaseInsensitive: true}, "git", "diff", "--cached", "--name-only", "--relative")
 
-	// The two dots represent [file state in the cache (e.g. added/green), file state not in the cache (red file)]
-	redFileCompleter   = PrefixCompleter[[]string](true, regexp.MustCompile(`^.[^\.]$`))
-	greenFileCompleter = PrefixCompleter[[]string](false, regexp.MustCompile(`^[^\.].$`))
+	repoUrl             = newGitArg("REPO", true, GitRunner.RemoteURL)
+	defRepoArg          = commander.Arg[string]("DEFAULT_BRANCH", "Default branch for this git repo")
+	forceDelete         = commander.BoolFlag("force-delete", 'f', "force delete the branch")
+	globalConfig        = commander.BoolFlag("global", 'g', "Whether or not to change the global setting")
+	newBranchFlag       = commander.BoolFlag("new-branch", 'n', "Whether or not to checkout a new branch")
+	whitespaceFlag      = commander.BoolValueFlag("whitespace", 'w', "Whether or not to show whitespace in diffs", "-w")
+	noopWhitespaceFlag  = commander.BoolFlag(whitespaceFlag.Name(), whitespaceFlag.ShortName(), "No-op so that when running add after `gd ... -w` we can keep the -w at the end", commander.Hidden[bool]())
+	gitLogArg           = commander.OptionalArg[int]("N", "Number of git logs to display", commander.NonNegative[int](), commander.Default(1))
+	gitLogDiffFlag      = commander.BoolFlag("diff", 'd', "Whether or not to diff the current changes against N commits prior")
+	pushUpstreamFlag    = commander.BoolFlag("upstream", 'u', "If set, push branch to upstream")
+	restackMergeFlag    = commander.BoolFlag("merge", 'm', "Merge each parent into its child instead of rebasing")
+	restackContinueFlag = commander.BoolFlag("continue", 'c', "Continue a restack after resolving conflicts")
+	reparentRebaseFlag  = commander.BoolFlag("rebase", 'r', "Rebase the branch onto its new parent")
+	endRestackFlag      = commander.BoolFlag("restack", 'r', "Rebase child branches onto the ended branch's parent")
+	hostArg             = commander.Arg[string]("HOST", "Hostname of the git remote")
+	hostTypeArg         = commander.Arg[string]("HOST_TYPE", "Type of git host", commander.SimpleCompleter[string]("bitbucket", "gitea", "github", "gitlab"))
+	prStackFlag         = commander.BoolFlag("stack", 's', "Output PR links for every branch in the current stack")
+	prMarkdownFlag      = commander.BoolFlag("markdown", 'm', "Output the stack PR links as a markdown table")
+	mvNewBranchArg      = commander.Arg[string]("NEW_BRANCH", "New branch name")
+	currentBranchArg    = newGitArg("CURRENT_BRANCH", false, GitRunner.CurrentBranch)
+)
 
-	addFlag = commander.BoolFlag("add", 'a', "If set, then files will be added")
+func branchTransformer(r GitRunner) *commander.Transformer[string] {
+	return &commander.Transformer[string]{F: func(s string, d *command.Data) (string, error) {
+		bs, err := resolveBranches(r, []string{s}, d)
+		if err != nil {
+			return "", err
+		}
+		return bs[0], nil
+	}}
+}
 
-	gitRootDirFunc = func(completionMode bool) *commander.ShellCommand[string] {
-		return &commander.ShellCommand[string]{
-			ArgName:     "GIT_ROOT",
-			CommandName: "git",
-			Args: []string{
-				"rev-parse",
-				"--show-toplevel",
-			},
-			ForwardStdout:     false,
-			HideStderr:        completionMode,
-			DontRunOnComplete: !completionMode,
-			// TODO: DontRunOnExecute/Usage or field for when it should run
+// resolveBranches maps each provided branch name to an existing local branch,
+// prepending the user prefix when only the prefixed branch exists.
+func resolveBranches(r GitRunner, ss []string, d *command.Data) ([]string, error) {
+	branches, err := r.Branches(nil, d, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git branches: %v", err)
+	}
+
+	var bs []string
+	for _, b := range branches {
+		bs = append(bs, b.Name)
+	}
+
+	var resolved []string
+	for _, s := range ss {
+		resolved = append(resolved, resolveBranch(s, bs, d))
+	}
+	return resolved, nil
+}
+
+func resolveBranch(s string, bs []string, d *command.Data) string {
+	// First check for an exact branch match, before adding the prefix.
+	// This accounts for instances where the branches `person/abc` and `abc` exist.
+	for _, b := range bs {
+		if s == b {
+			return s
+		}
+	}
+
+	// Then check if the branch with the user prefix exists
+	for _, b := range bs {
+		withUser := fmt.Sprintf("%s/%s", userArg.Get(d), s)
+		if withUser == b {
+			return withUser
 		}
 	}
-	gitRootDir               = gitRootDirFunc(false)
-	gitRootDirCompletionMode = gitRootDirFunc(true)
 
-	diffCompleter = commander.CompleterFromFunc(func(ss []string, d *command.Data) (*command.Completion, error) {
+	// Otherwise, just return the branch name the user provided
+	return s
+}
+
+func CLI() *git {
+	return &git{}
+}
+
+// CLIWithRunner returns the CLI with the git state read by r (e.g. a
+// FakeGitRunner) rather than by running git.
+func CLIWithRunner(r GitRunner) *git {
+	return &git{runner: r}
+}
+
+// gitRunner returns the GitRunner that the CLI reads the git state with.
+func (g *git) gitRunner() GitRunner {
+	if g.runner == nil {
+		return &ShellGitRunner{}
+	}
+	return g.runner
+}
+
+// diffCompleter completes the files that `g d` would show changes for.
+func (g *git) diffCompleter() commander.Completer[[]string] {
+	return commander.CompleterFromFunc(func(ss []string, d *command.Data) (*command.Completion, error) {
 
 		// Get git root
-		gitRoot, err := gitRootDirCompletionMode.Run(nil, d)
+		r := g.gitRunner()
+		gitRoot, err := r.Root(nil, d)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get git root: %v", err)
 		}
 
 		// Get diffable files
-		diffableFiles := &commander.ShellCommand[[]string]{
-			CommandName: "git",
-			Args: []string{
-				"diff",
-				"--name-only",
-			},
-
-			ForwardStdout: false,
-			HideStderr:    true,
-		}
-		files, err := diffableFiles.Run(nil, d)
+		// Completion must not change the config, so a detected default branch
+		// isn't cached.
+		base, err := g.diffBase(nil, d, false, func() (string, error) {
+			url, err := r.RemoteURL(nil, d)
+			return strings.TrimSpace(url), err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to get diffable files: %v", err)
+			return nil, err
+		}
+		// Without a base, `g d` shows unstaged changes, but staged files are
+		// suggested too.
+		diffs := [][]string{{base}}
+		if base == "" {
+			diffs = [][]string{nil, {"--cached"}}
+		}
+		var files []string
+		for _, args := range diffs {
+			fs, err := r.DiffNameStatus(nil, d, args...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get diffable files: %v", err)
+			}
+			files = append(files, fs...)
 		}
 
 		// Get absolute path for diffable files
 		var absFiles []string
+		has := map[string]bool{}
 		for _, f := range files {
-			absFiles = append(absFiles, filepath.Join(gitRoot, f))
+			if !has[f] {
+				has[f] = true
+				absFiles = append(absFiles, filepath.Join(gitRoot, f))
+			}
 		}
 
 		// Create suggestions
@@ -186,106 +215,77 @@ var (
 			CaseInsensitive: true,
 		}, nil
 	})
-	greenFileCompleterNoDeletes = commander.ShellCommandCompleterWithOpts[[]string](&command.Completion{Distinct: true, CaseInsensitive: true}, "git", "diff", "--cached", "--name-only", "--relative")
-
-	addFileCompleter = redFileCompleter
-	addFilesArg      = commander.ListArg[string]("FILES", "Files to add", 0, command.UnboundedList, addFileCompleter)
-	rmFilesArg       = commander.ListArg[string]("FILES", "Files to remove", 1, command.UnboundedList, addFileCompleter)
-	allFileCompleter = PrefixCompleter[[]string](true, regexp.MustCompile(".*"))
-	statusFilesArg   = commander.ListArg[string]("FILES", "Files to add", 0, command.UnboundedList, allFileCompleter)
-	repoUrl          = &commander.ShellCommand[string]{
-		ArgName:     "REPO",
-		CommandName: "git",
-		Args: []string{
-			"config",
-			"--get",
-			"remote.origin.url",
-		},
-	}
-	defRepoArg         = commander.Arg[string]("DEFAULT_BRANCH", "Default branch for this git repo")
-	forceDelete        = commander.BoolFlag("force-delete", 'f', "force delete the branch")
-	globalConfig       = commander.BoolFlag("global", 'g', "Whether or not to change the global setting")
-	newBranchFlag      = commander.BoolFlag("new-branch", 'n', "Whether or not to checkout a new branch")
-	whitespaceFlag     = commander.BoolValueFlag("whitespace", 'w', "Whether or not to show whitespace in diffs", "-w")
-	noopWhitespaceFlag = commander.BoolFlag(whitespaceFlag.Name(), whitespaceFlag.ShortName(), "No-op so that when running add after `gd ... -w` we can keep the -w at the end", commander.Hidden[bool]())
-	uaArgs             = commander.ListArg[string](
-		"FILE", "Files to un-add",
-		0, command.UnboundedList,
-		greenFileCompleter,
-	)
-	diffArgs = commander.ListArg[string](
-		"FILE", "Files to diff",
-		0, command.UnboundedList,
-		diffCompleter,
-	)
-	ucArgs = commander.ListArg[string](
-		"FILE", "Files to un-change",
-		1, command.UnboundedList,
-		redFileCompleter,
-	)
-	gitLogArg      = commander.OptionalArg[int]("N", "Number of git logs to display", commander.NonNegative[int](), commander.Default(1))
-	gitLogDiffFlag = commander.BoolFlag("diff", 'd', "Whether or not to diff the current changes against N commits prior")
-	stashArgs      = commander.ListArg[string](
-		"STASH_ARGS", "Args to pass to `git stash push/pop`",
-		0, command.UnboundedList,
-		allFileCompleter,
-	)
-	pushUpstreamFlag = commander.BoolFlag("upstream", 'u', "If set, push branch to upstream")
-	currentBranchArg = createCurrentBranchArg(false)
-)
-
-func createCurrentBranchArg(hideStderr bool) *commander.ShellCommand[string] {
-	return &commander.ShellCommand[string]{
-		ArgName:     "CURRENT_BRANCH",
-		CommandName: "git",
-		Args: []string{
-			"rev-parse",
-			"--abbrev-ref",
-			"HEAD",
-		},
-		DontRunOnComplete: true,
-		HideStderr:        hideStderr,
-	}
 }
 
-func CLI() *git {
-	return &git{}
+// diffBase returns the revision that `g d` compares against for the provided
+// flags. An empty string means that the working tree is compared against the
+// index. remoteURL is only called if the default branch is needed, and a
+// detected default branch is only cached if cache is set (see
+// remoteDefaultBranch).
+func (g *git) diffBase(o command.Output, d *command.Data, cache bool, remoteURL func() (string, error)) (string, error) {
+	switch {
+	case prevCommitFlag.Get(d):
+		return "@~1", nil
+	case diffParentFlag.Get(d):
+		return g.parentMergeBase(o, d)
+	case mainFlag.Get(d):
+		url, err := remoteURL()
+		if err != nil {
+			return "", fmt.Errorf("failed to get remote url: %v", err)
+		}
+		if b, ok := g.remoteDefaultBranch(d, url, cache); ok {
+			return b, nil
+		}
+		return DefaultDefaultBranch, nil
+	}
+	return "", nil
 }
 
 // TODO: CompleteWrapper (CompleteExtender?) here too
-func branchCompleter(s string, d *command.Data) (*command.Completion, error) {
-	c, err := commander.ShellCommandCompleter[string]("git", "branch", "--list").Complete(s, d)
-	if c == nil || err != nil {
-		return c, err
+func branchCompletion(r GitRunner, s string, d *command.Data) (*command.Completion, error) {
+	branches, err := r.Branches(nil, d, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git branches: %v", err)
 	}
 
-	r := map[string]bool{}
-	for _, s := range c.Suggestions {
-		s = strings.TrimSpace(s)
-		if !strings.Contains(s, "*") {
-			r[s] = true
+	names := map[string]bool{}
+	for _, b := range branches {
+		if !b.Current {
+			names[b.Name] = true
 			userPrefix := fmt.Sprintf("%s/", userArg.Get(d))
-			if suffix, ok := strings.CutPrefix(s, userPrefix); ok {
-				r[suffix] = true
+			if suffix, ok := strings.CutPrefix(b.Name, userPrefix); ok {
+				names[suffix] = true
 			}
 		}
 	}
 
-	c.Suggestions = nil
-	for k := range r {
+	c := &command.Completion{}
+	for k := range names {
 		c.Suggestions = append(c.Suggestions, k)
 	}
 	return c, nil
 }
 
+// BranchCompleter completes the local branches (read with a ShellGitRunner).
 func BranchCompleter() commander.Completer[string] {
-	return commander.CompleterFromFunc(branchCompleter)
+	return branchCompleter(&ShellGitRunner{})
 }
 
+// BranchesCompleter completes distinct local branches (read with a
+// ShellGitRunner).
 func BranchesCompleter() commander.Completer[[]string] {
+	return branchesCompleter(&ShellGitRunner{})
+}
 
+func branchCompleter(r GitRunner) commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, d *command.Data) (*command.Completion, error) {
+		return branchCompletion(r, s, d)
+	})
+}
+
+func branchesCompleter(r GitRunner) commander.Completer[[]string] {
 	return commander.CompleterFromFunc(func(ss []string, d *command.Data) (*command.Completion, error) {
-		c, err := branchCompleter(ss[len(ss)-1], d)
+		c, err := branchCompletion(r, ss[len(ss)-1], d)
 		if c == nil || err != nil {
 			return c, err
 		}
@@ -328,55 +328,158 @@ func GitAliasers() sourcerer.Option {
 		"gl":   {"g", "pr-link"},
 		"grm":  {"g", "rm"},
 		"gend": {"g", "end"},
+		"gmv":  {"g", "mv"},
+		"gwt":  {"g", "wt"},
 	})
 }
 
 type git struct {
-	MainBranches   map[string]string
-	DefaultBranch  string
-	ParentBranches map[string]string
-	// Map from repo path to previous branch
-	PreviousBranches map[string]string
-	changed          bool
+	MainBranches map[string]string
+	// Set of repo urls whose MainBranches entry was detected from the remote's
+	// HEAD (rather than set with `g cfg main set`)
+	DetectedMainBranches map[string]bool
+	DefaultBranch        string
+	// Map from repo identity (see GitRunner.RepoID) to the repo's parent branch
+	// graph (a map from branch to parent branch). All worktrees of a repo share
+	// the same graph.
+	RepoParentBranches map[string]map[string]string
+	// Map from repo path to recently checked out branches (most recent first)
+	BranchHistory map[string][]*BranchVisit
+	// Map from hostname to host type (see HostProviders)
+	Hosts map[string]string
+	// Map from repo identity to the repo's restack that stopped on conflicts
+	// (see `g restack --continue`)
+	Restacks map[string]*Restack
+	// DirectExecution is whether git commands are run directly rather than
+	// through generated shell commands (see executable)
+	DirectExecution bool
+	changed         bool
+
+	// runner reads the state of the git repo (see gitRunner).
+	runner GitRunner
+
+	// repoID is the identity of the current repo, and parentBranches is its
+	// parent branch graph. Both are set by loadRepoParents.
+	repoID         string
+	parentBranches map[string]string
+	// legacyParentBranches are parent branches from configs that predate
+	// RepoParentBranches. Each entry is claimed by the first repo that is
+	// loaded in which the branch exists.
+	legacyParentBranches map[string]string
 }
 
 func (g *git) Changed() bool {
 	return g.changed
 }
+
+// UnmarshalJSON loads the git config, migrating any fields from older versions
+// of the config.
+func (g *git) UnmarshalJSON(b []byte) error {
+	type gitAlias git
+	legacy := struct {
+		*gitAlias
+		// PreviousBranches was a map from repo path to previous branch. It was
+		// replaced by BranchHistory.
+		PreviousBranches map[string]string
+		// ParentBranches was a parent branch graph shared by all repos. It was
+		// replaced by RepoParentBranches.
+		ParentBranches map[string]string
+	}{
+		gitAlias: (*gitAlias)(g),
+	}
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		return err
+	}
+	// The repo that the parent branches belong to isn't known until a command
+	// runs in it (see loadRepoParents).
+	g.legacyParentBranches = legacy.ParentBranches
+
+	for gitRoot, branch := range legacy.PreviousBranches {
+		if len(g.BranchHistory[gitRoot]) > 0 {
+			continue
+		}
+		if g.BranchHistory == nil {
+			g.BranchHistory = map[string][]*BranchVisit{}
+		}
+		g.BranchHistory[gitRoot] = []*BranchVisit{{Branch: branch}}
+		g.changed = true
+	}
+	return nil
+}
+
+// MarshalJSON saves the git config. Legacy parent branches that haven't been
+// claimed by a repo yet are kept so they aren't lost.
+func (g *git) MarshalJSON() ([]byte, error) {
+	type gitAlias git
+	return json.Marshal(struct {
+		*gitAlias
+		ParentBranches map[string]string `json:",omitempty"`
+	}{
+		gitAlias:       (*gitAlias)(g),
+		ParentBranches: g.legacyParentBranches,
+	})
+}
+
 func (*git) Setup() []string { return nil }
 func (*git) Name() string    { return "g" }
 
 func (g *git) GetDefaultBranch(d *command.Data) string {
-	if g.MainBranches == nil {
-		if len(g.DefaultBranch) == 0 {
-			return DefaultDefaultBranch
-		}
-		return g.DefaultBranch
+	if b, ok := g.defaultBranch(d); ok {
+		return b
+	}
+	return DefaultDefaultBranch
+}
+
+// defaultBranch returns the default branch for the current repo. The branch is
+// resolved in the following order:
+//  1. The repo's configured (or previously detected) default branch
+//  2. The global default branch
+//  3. The remote's HEAD branch (which is then cached in MainBranches)
+func (g *git) defaultBranch(d *command.Data) (string, bool) {
+	return g.remoteDefaultBranch(d, repoUrl.Get(d), true)
+}
+
+// remoteDefaultBranch returns the default branch for the repo with the
+// provided remote url (see defaultBranch). The remote's HEAD branch is only
+// cached in MainBranches if cache is set.
+func (g *git) remoteDefaultBranch(d *command.Data, url string, cache bool) (string, bool) {
+	if m, ok := g.MainBranches[url]; ok {
+		return m, true
+	}
+	if len(g.DefaultBranch) > 0 {
+		return g.DefaultBranch, true
+	}
+	rh, err := detectRemoteHead(g.gitRunner(), d, url)
+	if err != nil || rh == "" {
+		return "", false
 	}
-	if m, ok := g.MainBranches[repoUrl.Get(d)]; ok {
-		return m
+	if !cache {
+		return rh, true
 	}
-	if len(g.DefaultBranch) == 0 {
-		return DefaultDefaultBranch
+	if g.MainBranches == nil {
+		g.MainBranches = map[string]string{}
+	}
+	if g.DetectedMainBranches == nil {
+		g.DetectedMainBranches = map[string]bool{}
 	}
-	return g.DefaultBranch
+	g.MainBranches[url] = rh
+	g.DetectedMainBranches[url] = true
+	g.changed = true
+	return rh, true
 }
 
+// PrefixCompleter completes the files in the git status whose XY code matches
+// one of prefixCodes. Untracked files are included if includeUnknown is set.
+// The status is read with a ShellGitRunner.
 func PrefixCompleter[T any](includeUnknown bool, prefixCodes ...*regexp.Regexp) commander.Completer[T] {
+	return prefixCompleter[T](&ShellGitRunner{}, includeUnknown, prefixCodes...)
+}
+
+func prefixCompleter[T any](r GitRunner, includeUnknown bool, prefixCodes ...*regexp.Regexp) commander.Completer[T] {
 	return commander.CompleterFromFunc(func(t T, d *command.Data) (*command.Completion, error) {
-		// prefixRegex := regexp.MustCompile(prefixCode)
-		bc := &commander.ShellCommand[[]string]{
-			ArgName:     "opts",
-			CommandName: "git",
-			Args: []string{
-				"status",
-				// Note: this requires that `git config status.relativePaths true`
-				"--porcelain=v2",
-			},
-		}
-		results, err := bc.Run(nil, d)
+		entries, err := gitStatus(r, d, "")
 		if err != nil {
-			return nil, fmt.Errorf("failed to get git status: %v", err)
+			return nil, err
 		}
 
 		var suggestions []string
@@ -388,30 +491,19 @@ func PrefixCompleter[T any](includeUnknown bool, prefixCodes ...*regexp.Regexp)
 			has[s] = true
 			suggestions = append(suggestions, s)
 		}
-		for _, result := range results {
-			// Format is the following for tracked files
-			// 1 .M ... 100644 100644 100644 e1548292489441c42682f38f2590e24d66a8587a e1548292489441c42682f38f2590e24d66a8587a sourcecontrol.go
-
-			// Format is the following for untracked files
-			// ? new_file.go
-
-			parts := strings.Split(result, " ")
-
-			// Check if it's an untracked file
-			if parts[0] == "?" {
-				file := strings.Join(parts[1:], " ")
+		for _, e := range entries {
+			switch e.Type {
+			case UntrackedEntry:
 				if includeUnknown {
-					addSuggestion(file)
+					addSuggestion(e.Path)
 				}
-				continue
-			}
-
-			// if file has a space in the name, we need to rejoin int
-			file := strings.Join(parts[8:], " ")
-			for _, rgx := range prefixCodes {
-				if rgx.MatchString(parts[1]) {
-					addSuggestion(file)
-					break
+			case IgnoredEntry:
+			default:
+				for _, rgx := range prefixCodes {
+					if rgx.MatchString(e.XY) {
+						addSuggestion(e.Path)
+						break
+					}
 				}
 			}
 		}
@@ -424,9 +516,74 @@ func PrefixCompleter[T any](includeUnknown bool, prefixCodes ...*regexp.Regexp)
 }
 
 func (g *git) Node() command.Node {
+	runner := g.gitRunner()
+
+	// The two dots represent [file state in the cache (e.g. added/green), file state not in the cache (red file)]
+	redFileCompleter := prefixCompleter[[]string](runner, true, regexp.MustCompile(`^.[^\.]$`))
+	greenFileCompleter := prefixCompleter[[]string](runner, false, regexp.MustCompile(`^[^\.].$`))
+	allFileCompleter := prefixCompleter[[]string](runner, true, regexp.MustCompile(".*"))
+
+	addFilesArg := commander.ListArg[string]("FILES", "Files to add", 0, command.UnboundedList, redFileCompleter)
+	rmFilesArg := commander.ListArg[string]("FILES", "Files to remove", 1, command.UnboundedList, redFileCompleter)
+	statusFilesArg := commander.ListArg[string]("FILES", "Files to add", 0, command.UnboundedList, allFileCompleter)
+	uaArgs := commander.ListArg[string](
+		"FILE", "Files to un-add",
+		0, command.UnboundedList,
+		greenFileCompleter,
+	)
+	ucArgs := commander.ListArg[string](
+		"FILE", "Files to un-change",
+		1, command.UnboundedList,
+		redFileCompleter,
+	)
+	stashArgs := commander.ListArg[string](
+		"STASH_ARGS", "Args to pass to `git stash push/pop`",
+		0, command.UnboundedList,
+		allFileCompleter,
+	)
+	conflictFilesArg := commander.ListArg[string](
+		"FILES", "Conflicted files to resolve",
+		1, command.UnboundedList,
+		conflictCompleter[[]string](runner),
+	)
+
+	branchesArg := commander.ListArg(
+		"BRANCH",
+		"Branch",
+		1,
+		command.UnboundedList,
+		branchesCompleter(runner),
+	)
+	reparentArgs := commander.ListArg[string](
+		"BRANCH", "Branch",
+		1, 1,
+		branchesCompleter(runner),
+		&commander.Transformer[[]string]{F: func(ss []string, d *command.Data) ([]string, error) {
+			return resolveBranches(runner, ss, d)
+		}},
+	)
+	baseFlag := commander.Flag[string]("base", 'b', "Branch to open the PR against", branchCompleter(runner))
+	mvOldBranchArg := commander.Arg(
+		"OLD_BRANCH",
+		"Branch to rename",
+		branchCompleter(runner),
+		branchTransformer(runner),
+	)
+	chBranchArg := commander.Arg(
+		"BRANCH",
+		"Branch",
+		g.recentBranchCompleter(),
+		branchTransformer(runner),
+	)
+	diffArgs := commander.ListArg[string](
+		"FILE", "Files to diff",
+		0, command.UnboundedList,
+		g.diffCompleter(),
+	)
+
 	return commander.DryRunWrap(
 		dryRunFlag,
-		&commander.BranchNode{
+		commander.SerialNodes(commander.FlagProcessor(directFlag), &commander.BranchNode{
 			Branches: map[string]command.Node{
 				// Configs
 				"cfg": commander.SerialNodes(
@@ -446,14 +603,18 @@ func (g *git) Node() command.Node {
 											keys := maps.Keys(g.MainBranches)
 											slices.Sort(keys)
 											for _, k := range keys {
-												o.Stdoutf("%s: %s\n", k, g.MainBranches[k])
+												source := "set"
+												if g.DetectedMainBranches[k] {
+													source = "detected"
+												}
+												o.Stdoutf("%s: %s (%s)\n", k, g.MainBranches[k], source)
 											}
 											return nil
 										}},
 									),
 									"set": commander.SerialNodes(
 										commander.FlagProcessor(globalConfig),
-										repoUrl,
+										repoUrl.processor(runner),
 										defRepoArg,
 										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
 											g.changed = true
@@ -468,13 +629,14 @@ func (g *git) Node() command.Node {
 												g.MainBranches = map[string]string{}
 											}
 											g.MainBranches[repoUrl.Get(d)] = defRepoArg.Get(d)
+											delete(g.DetectedMainBranches, repoUrl.Get(d))
 											o.Stdoutf("Setting default branch for %s to %s\n", repoUrl.Get(d), defRepoArg.Get(d))
 											return nil
 										}},
 									),
 									"unset": commander.SerialNodes(
 										commander.FlagProcessor(globalConfig),
-										repoUrl,
+										repoUrl.processor(runner),
 										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
 											if globalConfig.Get(d) {
 												g.DefaultBranch = ""
@@ -493,19 +655,109 @@ func (g *git) Node() command.Node {
 												return nil
 											}
 											delete(g.MainBranches, rn)
+											delete(g.DetectedMainBranches, rn)
 											o.Stdoutln("Deleting default branch for", rn)
 											g.changed = true
 											return nil
 										}},
 									),
 								}},
+							"host": &commander.BranchNode{
+								Branches: map[string]command.Node{
+									"show": commander.SerialNodes(
+										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+											if len(g.Hosts) == 0 {
+												o.Stdoutln("No host types set")
+												return nil
+											}
+											hosts := maps.Keys(g.Hosts)
+											slices.Sort(hosts)
+											for _, h := range hosts {
+												o.Stdoutf("%s: %s\n", h, g.Hosts[h])
+											}
+											return nil
+										}},
+									),
+									"set": commander.SerialNodes(
+										hostArg,
+										hostTypeArg,
+										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+											host, hostType := hostArg.Get(d), hostTypeArg.Get(d)
+											if _, ok := HostProviders[hostType]; !ok {
+												types := maps.Keys(HostProviders)
+												slices.Sort(types)
+												return o.Stderrf("Unknown host type %q (must be one of %v)\n", hostType, types)
+											}
+											if g.Hosts == nil {
+												g.Hosts = map[string]string{}
+											}
+											g.Hosts[host] = hostType
+											g.changed = true
+											o.Stdoutf("Setting host type for %s to %s\n", host, hostType)
+											return nil
+										}},
+									),
+									"unset": commander.SerialNodes(
+										hostArg,
+										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+											host := hostArg.Get(d)
+											if _, ok := g.Hosts[host]; !ok {
+												o.Stdoutln("No host type set for", host)
+												return nil
+											}
+											delete(g.Hosts, host)
+											g.changed = true
+											o.Stdoutln("Deleting host type for", host)
+											return nil
+										}},
+									),
+								}},
+							"direct": &commander.BranchNode{
+								Branches: map[string]command.Node{
+									"show": commander.SerialNodes(
+										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+											if g.DirectExecution {
+												o.Stdoutln("Git commands are run directly")
+											} else {
+												o.Stdoutln("Git commands are run through the shell")
+											}
+											return nil
+										}},
+									),
+									"set": commander.SerialNodes(
+										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+											g.DirectExecution = true
+											g.changed = true
+											o.Stdoutln("Running git commands directly")
+											return nil
+										}},
+									),
+									"unset": commander.SerialNodes(
+										&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+											if !g.DirectExecution {
+												o.Stdoutln("Direct execution is not set")
+												return nil
+											}
+											g.DirectExecution = false
+											g.changed = true
+											o.Stdoutln("Running git commands through the shell")
+											return nil
+										}},
+									),
+								}},
+							"prune": commander.SerialNodes(
+								commander.Description("Remove metadata for branches and directories that no longer exist"),
+								commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+									return g.prune(o, d)
+								}, nil),
+							),
 						}},
 				),
 
 				// Simple commands
 				"b": commander.SerialNodes(
 					commander.Description("Branch"),
-					commander.SimpleExecutableProcessor("git branch"),
+					g.gitExecutable("branch"),
 				),
 				"current": commander.SerialNodes(
 					commander.Description("Display current branch"),
@@ -517,8 +769,7 @@ func (g *git) Node() command.Node {
 						suffixFlag,
 					),
 					commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
-						cba := createCurrentBranchArg(true)
-						branch, err := cba.Run(o, d)
+						branch, err := runner.CurrentBranch(nil, d)
 						if err != nil {
 							if ignoreNoBranch.Get(d) {
 								return nil
@@ -531,18 +782,13 @@ func (g *git) Node() command.Node {
 						}
 
 						if parentFormatFlag.Provided(d) {
-							contains := map[string]bool{
-								branch: true,
+							if err := g.loadRepoParents(nil, d); err != nil {
+								return o.Err(err)
 							}
-							var branchPath []string
-							for parent, ok := g.ParentBranches[branch]; ok; parent, ok = g.ParentBranches[parent] {
-								if contains[parent] {
-									return o.Stderrln("cycle detected in parent branches")
-								}
-								contains[parent] = true
-								branchPath = append(branchPath, parent)
+							branchPath, err := g.ancestors(branch)
+							if err != nil {
+								return o.Err(err)
 							}
-							slices.Reverse(branchPath)
 							for _, parent := range branchPath {
 								output = append(output, fmt.Sprintf(parentFormatFlag.Get(d), parent))
 							}
@@ -555,55 +801,47 @@ func (g *git) Node() command.Node {
 				"l": commander.SerialNodes(
 					commander.Description("Pull"),
 					sshNode,
-					commander.SimpleExecutableProcessor(
-						"git pull",
-					),
+					g.gitExecutable("pull"),
 				),
 				// upstream push with pr link
 				"up": commander.SerialNodes(
 					commander.Description("Push upstream and output PR link"),
-					currentBranchArg,
-					repoUrl,
+					g.repoParentsProcessor(),
+					commander.FlagProcessor(
+						baseFlag,
+					),
+					currentBranchArg.processor(runner),
+					repoUrl.processor(runner),
 
 					// git push upstream
 					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
-						sc := &commander.ShellCommand[string]{
-							CommandName: "git",
-							Args: []string{
-								"push",
-								"--set-upstream",
-								"origin",
-								currentBranchArg.Get(d),
-							},
-							HideStderr: true,
-						}
-						if _, err := sc.Run(o, d); err != nil {
+						if err := runner.PushUpstream(nil, d, currentBranchArg.Get(d)); err != nil {
 							return o.Annotatef(err, "failed to run git push")
 						}
 
-						return g.printPRLink(o, d)
+						return g.printPRLink(o, d, baseFlag.Get(d))
 					}},
 				),
 				"p": commander.SerialNodes(
 					commander.Description("Push"),
 					commander.FlagProcessor(pushUpstreamFlag),
-					commander.IfData(pushUpstreamFlag.Name(), currentBranchArg),
+					commander.IfData(pushUpstreamFlag.Name(), currentBranchArg.processor(runner)),
 					sshNode,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 						if pushUpstreamFlag.Get(d) {
-							pushCmd := fmt.Sprintf("git push --set-upstream origin %q", currentBranchArg.Get(d))
-							o.Stdoutln(pushCmd)
-							return []string{pushCmd}, nil
+							args := []string{"push", "--set-upstream", "origin", currentBranchArg.Get(d)}
+							o.Stdoutln(gitShellCommand(args...))
+							return gitExecution(args), nil
 						}
-						return []string{"git push"}, nil
+						return gitExecution([]string{"push"}), nil
 					}),
 				),
 				"pp": commander.SerialNodes(
 					commander.Description("Pull and push"),
 					sshNode,
-					executableJoinByOS(
-						"git pull",
-						"git push",
+					g.gitExecutable(
+						"pull",
+						"push",
 					),
 					commander.SimpleExecutableProcessor(),
 				),
@@ -613,43 +851,31 @@ func (g *git) Node() command.Node {
 				),
 				"uco": commander.SerialNodes(
 					commander.Description("Undo commit"),
-					commander.SimpleExecutableProcessor("git reset HEAD~"),
+					g.gitExecutable("reset HEAD~"),
 				),
 				"f": commander.SerialNodes(
 					commander.Description("Git fetch"),
-					commander.SimpleExecutableProcessor("git fetch"),
+					g.gitExecutable("fetch"),
 				),
 				"op": commander.SerialNodes(
 					commander.Description("Git stash pop"),
 					stashArgs,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						var r []string
-						for _, c := range stashArgs.Get(d) {
-							r = append(r, fmt.Sprintf("%q", c))
-						}
-						return []string{
-							fmt.Sprintf("git stash pop %s", strings.Join(r, " ")),
-						}, nil
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						return gitExecution(append([]string{"stash", "pop"}, stashArgs.Get(d)...)), nil
 					}),
 				),
 				"ush": commander.SerialNodes(
 					commander.Description("Git stash push"),
 					stashArgs,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						var r []string
-						for _, c := range stashArgs.Get(d) {
-							r = append(r, fmt.Sprintf("%q", c))
-						}
-						return []string{
-							fmt.Sprintf("git stash push %s", strings.Join(r, " ")),
-						}, nil
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						return gitExecution(append([]string{"stash", "push"}, stashArgs.Get(d)...)), nil
 					}),
 				),
 
 				// Complex commands
 				"am": commander.SerialNodes(
 					commander.Description("Git amend"),
-					commander.SimpleExecutableProcessor("git commit --amend --no-edit"),
+					g.gitExecutable("commit --amend --no-edit"),
 				),
 				// Git log
 				"lg": commander.SerialNodes(
@@ -659,56 +885,53 @@ func (g *git) Node() command.Node {
 						whitespaceFlag,
 					),
 					gitLogArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 						if gitLogDiffFlag.Get(d) {
-							return []string{
-								fmt.Sprintf("git diff HEAD~%d %v", gitLogArg.Get(d), whitespaceFlag.Get(d)),
-							}, nil
+							args := []string{"diff", fmt.Sprintf("HEAD~%d", gitLogArg.Get(d))}
+							if whitespaceFlag.Get(d) != "" {
+								args = append(args, whitespaceFlag.Get(d))
+							}
+							return gitExecution(args), nil
 						}
-						return []string{
-							fmt.Sprintf("git log -n %d", gitLogArg.Get(d)),
-						}, nil
+						return gitExecution([]string{"log", "-n", fmt.Sprint(gitLogArg.Get(d))}), nil
 					}),
 				),
 				// Go back to previous branch
 				"pb": commander.SerialNodes(
 					commander.Description("Checkout previous branch"),
-					gitRootDir,
-					currentBranchArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						gitRoot := gitRootDir.Get(d)
-						prevBranch, ok := g.PreviousBranches[gitRoot]
-						if !ok {
-							return nil, o.Stderrln("no previous branch exists")
-						}
-						g.setPreviousBranch(gitRoot, currentBranchArg.Get(d))
-						return []string{
-							fmt.Sprintf("git checkout %s", prevBranch),
-						}, nil
-					}),
+					gitRootDir.processor(runner),
+					currentBranchArg.processor(runner),
+					pbArg,
+					g.executable(g.previousBranch),
+				),
+				// Branch history
+				"hist": commander.SerialNodes(
+					commander.Description("List recently checked out branches"),
+					gitRootDir.processor(runner),
+					&commander.ExecutorProcessor{F: g.printHistory},
 				),
 				// Checkout main
 				"m": commander.SerialNodes(
 					commander.Description("Checkout main"),
-					gitRootDir,
-					currentBranchArg,
-					repoUrl,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						g.setPreviousBranch(gitRootDir.Get(d), currentBranchArg.Get(d))
-						return []string{
-							fmt.Sprintf("git checkout %s", g.GetDefaultBranch(d)),
-						}, nil
+					gitRootDir.processor(runner),
+					currentBranchArg.processor(runner),
+					repoUrl.processor(runner),
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						branch := g.GetDefaultBranch(d)
+						g.recordCheckout(gitRootDir.Get(d), currentBranchArg.Get(d), branch)
+						return gitExecution([]string{"checkout", branch}), nil
 					}),
 				),
 				// Merge main
 				"mm": commander.SerialNodes(
 					commander.Description("Merge main"),
-					repoUrl,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						return []string{
-							fmt.Sprintf("git merge %s", g.GetDefaultBranch(d)),
-						}, nil
-					}),
+					commander.FlagProcessor(
+						mmFetchFlag,
+						mmRebaseFlag,
+						mmParentFlag,
+					),
+					repoUrl.processor(runner),
+					g.executable(g.mergeMain),
 				),
 				// Commit
 				"c": commander.SerialNodes(
@@ -724,23 +947,15 @@ func (g *git) Node() command.Node {
 							return pushFlag.Get(d)
 						},
 					),
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						r := []string{
-							// Replace quoted newlines with actual newlines
-							strings.ReplaceAll(
-								fmt.Sprintf("git commit %s-m %q", nvFlag.Get(d), strings.Join(messageArg.Get(d), " ")),
-								`\n`,
-								"\n",
-							),
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						e := &execution{
+							git:     [][]string{commitArgs(d)},
+							success: "Success!",
 						}
 						if pushFlag.Get(d) {
-							r = append(r,
-								"git push",
-							)
+							e.git = append(e.git, []string{"push"})
 						}
-						r = append(r, "echo Success!")
-
-						return joinByOS(r...)
+						return e, nil
 					}),
 				),
 
@@ -752,45 +967,133 @@ func (g *git) Node() command.Node {
 					),
 					messageArg,
 					sshNode,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						return joinByOS(
-							fmt.Sprintf("git commit %s-m %q", nvFlag.Get(d), strings.Join(messageArg.Get(d), " ")),
-							"git push",
-							"echo Success!",
-						)
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						return &execution{
+							git:     [][]string{commitArgs(d), {"push"}},
+							success: "Success!",
+						}, nil
 					}),
 				),
 
 				// Squash
-				/*"q": command.CacheNode(commitCacheKey, g, commander.SerialNodes(
-					commander.Description("Squash local commits"),
+				"q": commander.SerialNodes(
+					commander.Description("Squash the current branch's commits into a single commit"),
+					g.repoParentsProcessor(),
 					commander.FlagProcessor(
 						nvFlag,
 						pushFlag,
 					),
 					messageArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						// TODO: Fix and test this
-						// TODO: also make sure to combine with "&&" if relevant
-						r := []string{
-							"git reset --soft HEAD~3",
-							fmt.Sprintf("git commit -m %q %s", strings.Join(messageArg.Get(d), " "), nvFlag.Get(d)),
-						}
-						if pushFlag.Get(d) {
-							r = append(r, "git push")
-						}
-						r = append(r, "echo Success!")
-						return joinByOS(r...)
-					})),
-				),*/
+					currentBranchArg.processor(runner),
+					repoUrl.processor(runner),
+					commander.If(
+						sshNode,
+						func(i *command.Input, d *command.Data) bool {
+							return pushFlag.Get(d)
+						},
+					),
+					g.executable(g.squash),
+				),
 
-				// Checkout branch
-				"pr-link": commander.SerialNodes(
-					commander.Description("Get PR link"),
-					currentBranchArg,
-					repoUrl,
+				// Restack
+				"restack": commander.SerialNodes(
+					commander.Description("Rebase (or merge) every branch in the current stack onto its updated parent"),
+					g.repoParentsProcessor(),
+					commander.FlagProcessor(
+						restackMergeFlag,
+						restackContinueFlag,
+					),
 					commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
-						return g.printPRLink(o, d)
+						// In dry-run mode, the git commands are output rather than run.
+						if dryRunFlag.Get(d) {
+							return g.restack(o, d)
+						}
+						ed.Executor = append(ed.Executor, g.restack)
+						return nil
+					}, nil),
+				),
+
+				// Rename branch
+				"mv": commander.SerialNodes(
+					commander.Description("Rename a branch and its recorded metadata"),
+					g.repoParentsProcessor(),
+					userArg,
+					mvOldBranchArg,
+					mvNewBranchArg,
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						oldBranch, newBranch := mvOldBranchArg.Get(d), mvNewBranchArg.Get(d)
+						roots, err := g.repoHistoryRoots(d)
+						if err != nil {
+							return nil, o.Err(err)
+						}
+						g.renameBranch(d, oldBranch, newBranch, roots)
+						return gitExecution([]string{"branch", "-m", oldBranch, newBranch}), nil
+					}),
+				),
+
+				// Change a branch's parent
+				"reparent": commander.SerialNodes(
+					commander.Description("Change the recorded parent of a branch"),
+					g.repoParentsProcessor(),
+					commander.FlagProcessor(
+						reparentRebaseFlag,
+					),
+					currentBranchArg.processor(runner),
+					userArg,
+					reparentArgs,
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						args := reparentArgs.Get(d)
+						branch, newParent := currentBranchArg.Get(d), args[0]
+						if len(args) > 1 {
+							branch, newParent = args[0], args[1]
+						}
+
+						oldParent := g.parentBranches[branch]
+						if err := g.setParent(branch, newParent); err != nil {
+							return nil, o.Err(err)
+						}
+						if oldParent == "" {
+							o.Stdoutf("Set parent of %s to %s\n", branch, newParent)
+						} else {
+							o.Stdoutf("Changed parent of %s from %s to %s\n", branch, oldParent, newParent)
+						}
+
+						if !reparentRebaseFlag.Get(d) {
+							return nil, nil
+						}
+						if oldParent == "" {
+							return gitExecution([]string{"rebase", newParent, branch}), nil
+						}
+						return gitExecution([]string{"rebase", "--onto", newParent, oldParent, branch}), nil
+					}),
+				),
+
+				// Parent branch graph
+				"tree": commander.SerialNodes(
+					commander.Description("Display the parent branch graph"),
+					g.repoParentsProcessor(),
+					currentBranchArg.processor(runner),
+					commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+						return g.printTree(o, d)
+					}, nil),
+				),
+
+				// Checkout branch
+				"pr-link": commander.SerialNodes(
+					commander.Description("Get PR link"),
+					g.repoParentsProcessor(),
+					commander.FlagProcessor(
+						baseFlag,
+						prStackFlag,
+						prMarkdownFlag,
+					),
+					currentBranchArg.processor(runner),
+					repoUrl.processor(runner),
+					commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+						if prStackFlag.Get(d) {
+							return g.printStackPRLinks(o, d, baseFlag.Get(d))
+						}
+						return g.printPRLink(o, d, baseFlag.Get(d))
 					}, nil),
 				),
 				"ch": commander.SerialNodes(
@@ -798,30 +1101,28 @@ func (g *git) Node() command.Node {
 					commander.FlagProcessor(
 						newBranchFlag,
 					),
-					gitRootDir,
-					currentBranchArg,
+					gitRootDir.processor(runner),
+					currentBranchArg.processor(runner),
 					userArg,
-					branchArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					chBranchArg,
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 
-						branchName := branchArg.Get(d)
+						branchName := chBranchArg.Get(d)
 
-						flag := ""
+						args := []string{"checkout"}
 						if newBranchFlag.Get(d) {
-							flag = "-b "
-							if g.ParentBranches == nil {
-								g.ParentBranches = map[string]string{}
+							args = append(args, "-b")
+							if err := g.loadRepoParents(o, d); err != nil {
+								return nil, o.Err(err)
 							}
-							g.ParentBranches[branchName] = currentBranchArg.Get(d)
+							g.setParentBranch(branchName, currentBranchArg.Get(d))
 						}
-						return []string{
-							fmt.Sprintf("git checkout %s%s", flag, branchName),
-						}, nil
+						return gitExecution(append(args, branchName)), nil
 					}),
 					// ExecutableProcessor runs before arg processing is done, so change
 					// will have been updated
 					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
-						g.setPreviousBranch(gitRootDir.Get(d), currentBranchArg.Get(d))
+						g.recordCheckout(gitRootDir.Get(d), currentBranchArg.Get(d), chBranchArg.Get(d))
 						return nil
 					}},
 				),
@@ -829,32 +1130,35 @@ func (g *git) Node() command.Node {
 				// Delete branch
 				"bd": commander.SerialNodes(
 					commander.Description("Delete branch"),
+					g.repoParentsProcessor(),
 					commander.FlagProcessor(forceDelete),
 					branchesArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 						flag := "-d"
 						if forceDelete.Get(d) {
 							flag = "-D"
 						}
 
-						var branches []string
+						roots, err := g.repoHistoryRoots(d)
+						if err != nil {
+							return nil, o.Err(err)
+						}
 						for _, b := range branchesArg.Get(d) {
-							branches = append(branches, fmt.Sprintf("%q", b))
-
-							if g.ParentBranches != nil {
-								if _, ok := g.ParentBranches[b]; ok {
-									delete(g.ParentBranches, b)
-									g.changed = true
-								}
-							}
+							g.removeBranch(b, roots)
 						}
 
-						return []string{
-							fmt.Sprintf("git branch %s %s", flag, strings.Join(branches, " ")),
-						}, nil
+						return gitExecution(append([]string{"branch", flag}, branchesArg.Get(d)...)), nil
 					}),
 				),
 
+				// Delete merged branches
+				"cleanup": commander.SerialNodes(
+					commander.Description("Delete local branches that have been merged into the default branch"),
+					g.repoParentsProcessor(),
+					repoUrl.processor(runner),
+					g.executable(g.cleanup),
+				),
+
 				// Diff
 				"d": commander.SerialNodes(
 					commander.Description("Diff"),
@@ -862,46 +1166,87 @@ func (g *git) Node() command.Node {
 					commander.FlagProcessor(
 						mainFlag,
 						prevCommitFlag,
+						diffParentFlag,
+						diffStatFlag,
+						diffNameOnlyFlag,
 						whitespaceFlag,
 						addFlag,
 					),
 					diffArgs,
-					repoUrl,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					repoUrl.processor(runner),
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 
 						if addFlag.Get(d) {
 							return g.add(diffArgs.Get(d)), nil
 						}
 
-						branch := "--"
-						if mainFlag.Get(d) {
-							branch = g.GetDefaultBranch(d)
+						args := []string{"diff"}
+						for _, opt := range []string{whitespaceFlag.Get(d), diffStatFlag.Get(d), diffNameOnlyFlag.Get(d)} {
+							if opt != "" {
+								args = append(args, opt)
+							}
 						}
-						if prevCommitFlag.Get(d) {
-							branch = `"$(git rev-parse @~1)"`
+
+						base, err := g.diffBase(o, d, true, func() (string, error) { return repoUrl.Get(d), nil })
+						if err != nil {
+							return nil, o.Err(err)
 						}
-						return []string{
-							fmt.Sprintf("git diff %s %s %s", whitespaceFlag.Get(d), branch, strings.Join(diffArgs.Get(d), " ")),
-						}, nil
+						if base != "" {
+							args = append(args, base)
+						}
+						return gitExecution(append(append(args, "--"), diffArgs.Get(d)...)), nil
 					}),
 				),
 
 				// End branch (after it is merged)
 				"end": commander.SerialNodes(
 					commander.Description("End a branch after it has been merged"),
-					currentBranchArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					g.repoParentsProcessor(),
+					commander.FlagProcessor(
+						forceDelete,
+						endRestackFlag,
+					),
+					currentBranchArg.processor(runner),
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 						currentBranch := currentBranchArg.Get(d)
-						parent, ok := g.ParentBranches[currentBranch]
+						parent, ok := g.parentBranches[currentBranch]
 						if !ok {
 							return nil, o.Stderrf("branch %s does not have a known parent branch\n", currentBranch)
 						}
 
-						return joinByOS(
-							fmt.Sprintf("git checkout %s", parent),
-							"git pull",
-							fmt.Sprintf("gbd %s", currentBranch),
-						)
+						cmds := [][]string{
+							{"checkout", parent},
+							{"pull"},
+						}
+						if endRestackFlag.Get(d) {
+							children := g.children(currentBranch)
+							for _, child := range children {
+								// Only replay the child's own commits, since the ended branch's
+								// commits are already in the parent.
+								cmds = append(cmds, []string{"rebase", "--onto", parent, currentBranch, child})
+							}
+							for _, b := range g.descendants(currentBranch) {
+								if !slices.Contains(children, b) {
+									cmds = append(cmds, []string{"rebase", "--fork-point", g.parentBranches[b], b})
+								}
+							}
+							if len(children) > 0 {
+								cmds = append(cmds, []string{"checkout", parent})
+							}
+						}
+
+						flag := "-d"
+						if forceDelete.Get(d) {
+							flag = "-D"
+						}
+						cmds = append(cmds, []string{"branch", flag, currentBranch})
+
+						roots, err := g.repoHistoryRoots(d)
+						if err != nil {
+							return nil, o.Err(err)
+						}
+						g.removeBranch(currentBranch, roots)
+						return gitExecution(cmds...), nil
 					}),
 					commander.EchoExecuteData(),
 				),
@@ -910,10 +1255,8 @@ func (g *git) Node() command.Node {
 				"uc": commander.SerialNodes(
 					commander.Description("Undo change"),
 					ucArgs,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						return []string{
-							fmt.Sprintf("git checkout -- %s", strings.Join(ucArgs.Get(d), " ")),
-						}, nil
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						return gitExecution(append([]string{"checkout", "--"}, ucArgs.Get(d)...)), nil
 					}),
 				),
 
@@ -921,15 +1264,13 @@ func (g *git) Node() command.Node {
 				"ua": commander.SerialNodes(
 					commander.Description("Undo add"),
 					uaArgs,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						args := "."
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						files := []string{"."}
 						if len(uaArgs.Get(d)) > 0 {
-							args = strings.Join(uaArgs.Get(d), " ")
+							files = uaArgs.Get(d)
 						}
 
-						return []string{
-							fmt.Sprintf("git reset -- %s", args),
-						}, nil
+						return gitExecution(append([]string{"reset", "--"}, files...)), nil
 					}),
 				),
 
@@ -937,8 +1278,11 @@ func (g *git) Node() command.Node {
 				"s": commander.SerialNodes(
 					commander.Description("Status"),
 					statusFilesArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						return []string{fmt.Sprintf("git status %s", strings.Join(statusFilesArg.Get(d), " "))}, nil
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						if files := statusFilesArg.Get(d); len(files) > 0 {
+							return gitExecution(append([]string{"status", "--"}, files...)), nil
+						}
+						return gitExecution([]string{"status"}), nil
 					}),
 				),
 
@@ -949,7 +1293,7 @@ func (g *git) Node() command.Node {
 					),
 					commander.Description("Add"),
 					addFilesArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
 						fs := addFilesArg.Get(d)
 						return g.add(fs), nil
 					}),
@@ -959,9 +1303,10 @@ func (g *git) Node() command.Node {
 				"rm": commander.SerialNodes(
 					commander.Description("Remove"),
 					rmFilesArg,
-					commander.ExecutableProcessor(func(o command.Output, d *command.Data) ([]string, error) {
-						fs := rmFilesArg.Get(d)
-						return []string{fmt.Sprintf("rm %s", strings.Join(fs, " "))}, nil
+					g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+						// Args are intentionally not preceded by `--` so flags (e.g. `-rf`)
+						// can be provided.
+						return programExecution("rm", rmFilesArg.Get(d)...), nil
 					}),
 				),
 
@@ -970,59 +1315,954 @@ func (g *git) Node() command.Node {
 					Branches: map[string]command.Node{
 						"a": commander.SerialNodes(
 							commander.Description("Abort"),
-							commander.SimpleExecutableProcessor("git rebase --abort"),
+							g.gitExecutable("rebase --abort"),
 							commander.EchoExecuteData(),
 						),
 						"c": commander.SerialNodes(
 							commander.Description("Continue"),
-							commander.SimpleExecutableProcessor("git rebase --continue"),
+							g.noConflictsProcessor(),
+							g.gitExecutable("rebase --continue"),
+							commander.EchoExecuteData(),
+						),
+						"s": commander.SerialNodes(
+							commander.Description("Skip"),
+							g.gitExecutable("rebase --skip"),
 							commander.EchoExecuteData(),
 						),
 					},
 				},
+
+				// Conflicts
+				"conflicts": commander.SerialNodes(
+					commander.Description("List files with merge conflicts"),
+					&commander.ExecutorProcessor{F: g.printConflicts},
+				),
+				"ours": commander.SerialNodes(
+					commander.Description("Resolve conflicts by taking our version of the files"),
+					conflictFilesArg,
+					g.resolveConflicts("ours", conflictFilesArg.Get),
+				),
+				"theirs": commander.SerialNodes(
+					commander.Description("Resolve conflicts by taking their version of the files"),
+					conflictFilesArg,
+					g.resolveConflicts("theirs", conflictFilesArg.Get),
+				),
+
+				// Worktrees
+				"wt": g.worktreeNode(),
 			},
 			Synonyms: commander.BranchSynonyms(map[string][]string{
 				"l": {"pl"},
 			}),
-		},
+		}),
 	)
 }
 
-func (g *git) printPRLink(o command.Output, d *command.Data) error {
+// prLinker returns a function that generates PR links for the provided
+// remote.
+func (g *git) prLinker(remote string) (func(base, branch string) string, error) {
+	r, err := ParseRemoteURL(remote)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := g.hostProvider(r)
+	if err != nil {
+		return nil, err
+	}
+	return func(base, branch string) string {
+		return hp.PRLink(r, base, branch)
+	}, nil
+}
+
+// prBase returns the branch that a PR for the provided branch should be
+// opened against. The base is resolved in the following order:
+//  1. The `--base` flag value (for the current branch only)
+//  2. The branch's recorded parent branch
+//  3. The repo's default branch (see defaultBranch)
+func (g *git) prBase(d *command.Data, branch, baseFlagValue string) (string, error) {
+	if branch == currentBranchArg.Get(d) && baseFlagValue != "" {
+		return baseFlagValue, nil
+	}
+	if pb, ok := g.parentBranches[branch]; ok {
+		return pb, nil
+	}
+	if db, ok := g.defaultBranch(d); ok {
+		return db, nil
+	}
+	return "", fmt.Errorf("Unknown parent branch for branch %s; and no default main branch set", branch)
+}
+
+// detectRemoteHead returns the branch that the origin remote's HEAD points to.
+// The local `refs/remotes/origin/HEAD` ref is checked first. If that isn't set
+// (e.g. the repo wasn't cloned) and the remote is on the local filesystem, then
+// the remote itself is queried.
+func detectRemoteHead(r GitRunner, d *command.Data, url string) (string, error) {
+	head, err := r.RemoteHead(nil, d)
+	if err == nil || !isLocalRemote(url) {
+		return head, err
+	}
+	return r.QueryRemoteHead(nil, d)
+}
+
+// isLocalRemote returns whether the provided remote url points to a repo on
+// the local filesystem. Only those remotes are queried with `git ls-remote`
+// so that we never block on the network.
+func isLocalRemote(url string) bool {
+	return strings.HasPrefix(url, "file://") || strings.HasPrefix(url, ".") || filepath.IsAbs(url)
+}
+
+func (g *git) printPRLink(o command.Output, d *command.Data, baseFlagValue string) error {
 	url := repoUrl.Get(d)
-	orgRepo := strings.TrimSuffix(url, ".git")
-	if strings.Contains(url, "git@") {
-		orgRepo = strings.TrimPrefix(orgRepo, "git@github.com:")
-	} else if strings.Contains(url, "https:") {
-		orgRepo = strings.TrimPrefix(orgRepo, "https://github.com/")
-	} else {
-		return o.Stderrf("Unknown git url format: %s\n", url)
+	prLink, err := g.prLinker(url)
+	if err != nil {
+		return o.Err(err)
 	}
 
 	cb := currentBranchArg.Get(d)
+	base, err := g.prBase(d, cb, baseFlagValue)
+	if err != nil {
+		return o.Err(err)
+	}
+	o.Stdoutln(prLink(base, cb))
+	return nil
+}
+
+// printStackPRLinks outputs a PR link for every branch in the current branch's
+// stack (from the root ancestor's child down through every descendant), each
+// compared against its own parent.
+func (g *git) printStackPRLinks(o command.Output, d *command.Data, baseFlagValue string) error {
+	url := repoUrl.Get(d)
+	prLink, err := g.prLinker(url)
+	if err != nil {
+		return o.Err(err)
+	}
+
+	cb := currentBranchArg.Get(d)
+	branchPath, err := g.ancestors(cb)
+	if err != nil {
+		return o.Err(err)
+	}
 
-	if pb, ok := g.ParentBranches[cb]; ok {
-		o.Stdoutf("https://github.com/%s/compare/%s...%s?expand=1\n", orgRepo, pb, cb)
+	// The root ancestor (the only branch in the stack without a recorded
+	// parent) is the base of the stack, so it doesn't get a PR.
+	var stack []string
+	if len(branchPath) > 0 {
+		stack = append(stack, branchPath[1:]...)
+		stack = append(stack, cb)
+	}
+	stack = append(stack, g.descendants(cb)...)
+	if len(stack) == 0 {
+		o.Stdoutf("No branches are stacked on %s\n", cb)
 		return nil
-	} else if mb, ok := g.MainBranches[url]; ok {
-		o.Stdoutf("https://github.com/%s/compare/%s...%s?expand=1\n", orgRepo, mb, cb)
+	}
+
+	type stackPR struct {
+		branch string
+		base   string
+		url    string
+	}
+	var prs []*stackPR
+	for _, b := range stack {
+		base, err := g.prBase(d, b, baseFlagValue)
+		if err != nil {
+			return o.Err(err)
+		}
+		prs = append(prs, &stackPR{b, base, prLink(base, b)})
+	}
+
+	if !prMarkdownFlag.Get(d) {
+		for _, pr := range prs {
+			o.Stdoutf("%s: %s\n", pr.branch, pr.url)
+		}
 		return nil
+	}
+
+	o.Stdoutln("### Stack")
+	o.Stdoutln("")
+	o.Stdoutln("| # | Branch | Base | PR |")
+	o.Stdoutln("| - | ------ | ---- | -- |")
+	for idx, pr := range prs {
+		o.Stdoutf("| %d | `%s` | `%s` | [compare](%s) |\n", idx+1, pr.branch, pr.base, pr.url)
+	}
+	return nil
+}
+
+func (g *git) add(files []string) *execution {
+	if len(files) == 0 {
+		return gitExecution([]string{"add", "."})
+	}
+	return gitExecution(append([]string{"add", "--"}, files...))
+}
+
+// ancestors returns the recorded parent chain of the provided branch, ordered
+// from the root ancestor down to the branch's immediate parent.
+func (g *git) ancestors(branch string) ([]string, error) {
+	contains := map[string]bool{
+		branch: true,
+	}
+	var branchPath []string
+	for parent, ok := g.parentBranches[branch]; ok; parent, ok = g.parentBranches[parent] {
+		if contains[parent] {
+			return nil, fmt.Errorf("cycle detected in parent branches")
+		}
+		contains[parent] = true
+		branchPath = append(branchPath, parent)
+	}
+	slices.Reverse(branchPath)
+	return branchPath, nil
+}
+
+// setParent records parent as the parent branch of branch, refusing to
+// introduce a cycle into the parent graph.
+func (g *git) setParent(branch, parent string) error {
+	if branch == parent {
+		return fmt.Errorf("branch %s cannot be its own parent", branch)
+	}
+	parentPath, err := g.ancestors(parent)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(parentPath, branch) {
+		return fmt.Errorf("setting the parent of %s to %s would create a cycle", branch, parent)
+	}
+
+	g.setParentBranch(branch, parent)
+	return nil
+}
+
+// loadRepoParents loads the parent branch graph of the current repo. git's
+// stderr is only shown if o is set.
+func (g *git) loadRepoParents(o command.Output, d *command.Data) error {
+	repoID, err := g.gitRunner().RepoID(o, d)
+	if err != nil {
+		return fmt.Errorf("failed to get git repo: %v", err)
+	}
+	g.repoID = strings.TrimSpace(repoID)
+	g.parentBranches = g.RepoParentBranches[g.repoID]
+
+	if len(g.legacyParentBranches) > 0 {
+		// Only claim the entries for branches that exist in this repo. The rest
+		// may belong to other repos.
+		local, err := localBranches(g.gitRunner(), d, "")
+		if err != nil {
+			return err
+		}
+		for branch, parent := range g.legacyParentBranches {
+			if !local[branch] {
+				continue
+			}
+			if _, ok := g.parentBranches[branch]; !ok {
+				g.setParentBranch(branch, parent)
+			}
+			delete(g.legacyParentBranches, branch)
+			g.changed = true
+		}
+	}
+	return nil
+}
+
+func (g *git) repoParentsProcessor() command.Processor {
+	return commander.SimpleProcessor(func(i *command.Input, o command.Output, d *command.Data, ed *command.ExecuteData) error {
+		return o.Err(g.loadRepoParents(o, d))
+	}, nil)
+}
+
+// setParentBranch records parent as the parent branch of branch in the current
+// repo's parent branch graph.
+func (g *git) setParentBranch(branch, parent string) {
+	if g.parentBranches == nil {
+		g.parentBranches = map[string]string{}
+	}
+	if g.RepoParentBranches == nil {
+		g.RepoParentBranches = map[string]map[string]string{}
+	}
+	g.parentBranches[branch] = parent
+	g.RepoParentBranches[g.repoID] = g.parentBranches
+	g.changed = true
+}
+
+// deleteParentBranch removes branch from the current repo's parent branch
+// graph.
+func (g *git) deleteParentBranch(branch string) {
+	if _, ok := g.parentBranches[branch]; !ok {
+		return
+	}
+	delete(g.parentBranches, branch)
+	if len(g.parentBranches) == 0 {
+		delete(g.RepoParentBranches, g.repoID)
+	}
+	g.changed = true
+}
+
+// renameBranch updates every stored reference to oldBranch to point to
+// newBranch instead. Only the branch histories of the provided git roots (see
+// repoHistoryRoots) are updated since other repos may have a branch with the
+// same name.
+func (g *git) renameBranch(d *command.Data, oldBranch, newBranch string, roots map[string]bool) {
+	if parent, ok := g.parentBranches[oldBranch]; ok {
+		g.deleteParentBranch(oldBranch)
+		g.setParentBranch(newBranch, parent)
+	}
+	for child, parent := range g.parentBranches {
+		if parent == oldBranch {
+			g.setParentBranch(child, newBranch)
+		}
+	}
+	for root, h := range g.BranchHistory {
+		if !roots[root] {
+			continue
+		}
+		for _, v := range h {
+			if v.Branch == oldBranch {
+				v.Branch = newBranch
+				g.changed = true
+			}
+		}
+	}
+	if rs, ok := g.Restacks[g.repoID]; ok && rs.Branch == oldBranch {
+		rs.Branch = newBranch
+		g.changed = true
+	}
+	g.renameDefaultBranch(d, oldBranch, newBranch)
+}
+
+// renameDefaultBranch updates the current repo's default branch (see
+// defaultBranch) if it is oldBranch. The repo's remote url is only read if
+// some default branch is oldBranch.
+func (g *git) renameDefaultBranch(d *command.Data, oldBranch, newBranch string) {
+	used := g.DefaultBranch == oldBranch
+	for _, m := range g.MainBranches {
+		used = used || m == oldBranch
+	}
+	if !used {
+		return
+	}
+
+	// Repos without an origin remote always use the global default branch.
+	url, _ := g.gitRunner().RemoteURL(nil, d)
+	if m, ok := g.MainBranches[url]; ok && url != "" {
+		if m == oldBranch {
+			g.MainBranches[url] = newBranch
+			g.changed = true
+		}
+		return
+	}
+	if g.DefaultBranch == oldBranch {
+		g.DefaultBranch = newBranch
+		g.changed = true
+	}
+}
+
+// removeBranch removes all stored metadata for a deleted branch. Children of
+// the branch are moved onto the branch's parent (or have their parent removed
+// if the branch has no recorded parent). Like renameBranch, only the branch
+// histories of the provided git roots are updated.
+func (g *git) removeBranch(branch string, roots map[string]bool) {
+	parent, hasParent := g.parentBranches[branch]
+	for _, child := range g.children(branch) {
+		if hasParent {
+			g.setParentBranch(child, parent)
+		} else {
+			g.deleteParentBranch(child)
+		}
+	}
+	g.deleteParentBranch(branch)
+
+	g.filterHistory(func(root string, v *BranchVisit) bool {
+		return !roots[root] || v.Branch != branch
+	})
+}
+
+// children returns the branches whose recorded parent is the provided branch.
+func (g *git) children(branch string) []string {
+	var r []string
+	for child, parent := range g.parentBranches {
+		if parent == branch {
+			r = append(r, child)
+		}
+	}
+	slices.Sort(r)
+	return r
+}
+
+// descendants returns all branches below the provided branch in topological
+// order (every branch appears after its parent).
+func (g *git) descendants(branch string) []string {
+	var r []string
+	queue := g.children(branch)
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		r = append(r, b)
+		queue = append(queue, g.children(b)...)
+	}
+	return r
+}
+
+// runGit runs git with the args and forwards its output.
+func (g *git) runGit(o command.Output, d *command.Data, args ...string) error {
+	return g.gitRunner().Run(o, d, "git", args...)
+}
+
+// Restack is a restack that stopped on conflicts.
+type Restack struct {
+	// Branch is the branch that the restack was started from.
+	Branch string
+	// Merge is whether parent branches are merged (rather than rebased).
+	Merge bool
+}
+
+// restack rebases (or merges) every branch in the current stack onto its
+// parent. In dry-run mode, the args of the git commands that would be run are
+// output instead (and no restack state is stored).
+func (g *git) restack(o command.Output, d *command.Data) error {
+	dryRun := dryRunFlag.Get(d)
+	runGit := func(args ...string) error {
+		if dryRun {
+			o.Stdoutf("%q\n", append([]string{"git"}, args...))
+			return nil
+		}
+		return g.runGit(o, d, args...)
+	}
+
+	var currentBranch string
+	merge := restackMergeFlag.Get(d)
+	if restackContinueFlag.Get(d) {
+		// The conflicted branch is checked out, so the branch and mode that the
+		// restack was started with are read from the config.
+		rs, ok := g.Restacks[g.repoID]
+		if !ok {
+			return o.Stderrln("no restack is in progress")
+		}
+		currentBranch, merge = rs.Branch, rs.Merge
+
+		continueArgs := []string{"-c", "core.editor=true", "rebase", "--continue"}
+		if merge {
+			continueArgs = []string{"commit", "--no-edit"}
+		}
+		if err := runGit(continueArgs...); err != nil {
+			return o.Annotatef(err, "failed to continue restack")
+		}
 	} else {
-		return o.Stderrf("Unknown parent branch for branch %s; and no default main branch set\n", cb)
+		var err error
+		currentBranch, err = g.gitRunner().CurrentBranch(nil, d)
+		if err != nil {
+			return o.Annotatef(err, "failed to get current branch")
+		}
+	}
+
+	branchPath, err := g.ancestors(currentBranch)
+	if err != nil {
+		return o.Err(err)
+	}
+	root := currentBranch
+	if len(branchPath) > 0 {
+		root = branchPath[0]
+	}
+
+	stack := g.descendants(root)
+	if len(stack) == 0 {
+		if !dryRun {
+			g.deleteRestack()
+		}
+		o.Stdoutf("No branches are stacked on %s\n", root)
+		return nil
+	}
+
+	// Restacking is idempotent (branches already on top of their parent are
+	// no-ops), so continuing simply re-walks the entire stack from the root.
+	for _, branch := range stack {
+		parent := g.parentBranches[branch]
+		var err error
+		if merge {
+			if err = runGit("checkout", branch); err == nil {
+				err = runGit("merge", "--no-edit", parent)
+			}
+		} else {
+			// --fork-point uses the parent's reflog so commits from the parent's
+			// previous position aren't replayed onto the child.
+			err = runGit("rebase", "--fork-point", parent, branch)
+		}
+		if err != nil {
+			if g.Restacks == nil {
+				g.Restacks = map[string]*Restack{}
+			}
+			g.Restacks[g.repoID] = &Restack{Branch: currentBranch, Merge: merge}
+			g.changed = true
+			return o.Annotatef(err, "failed to restack %s onto %s; resolve the conflicts and run `g restack --continue`", branch, parent)
+		}
+	}
+
+	if !dryRun {
+		g.deleteRestack()
+	}
+
+	if err := runGit("checkout", currentBranch); err != nil {
+		return o.Annotatef(err, "failed to checkout %s", currentBranch)
+	}
+	if dryRun {
+		return nil
+	}
+	o.Stdoutf("Restacked %d branch(es) on %s\n", len(stack), root)
+	return nil
+}
+
+// deleteRestack removes the current repo's stopped restack (if any).
+func (g *git) deleteRestack() {
+	if _, ok := g.Restacks[g.repoID]; ok {
+		delete(g.Restacks, g.repoID)
+		g.changed = true
 	}
 }
 
-func (g *git) setPreviousBranch(gitRoot, branch string) {
-	if g.PreviousBranches == nil {
-		g.PreviousBranches = map[string]string{}
+// localBranches returns the set of local branch names for the repo in dir (or
+// the current directory if dir is empty).
+func localBranches(r GitRunner, d *command.Data, dir string) (map[string]bool, error) {
+	branches, err := r.Branches(nil, d, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git branches: %v", err)
+	}
+	bs := map[string]bool{}
+	for _, b := range branches {
+		bs[b.Name] = true
+	}
+	return bs, nil
+}
+
+func (g *git) printTree(o command.Output, d *command.Data) error {
+	if len(g.parentBranches) == 0 {
+		o.Stdoutln("No parent branches recorded")
+		return nil
+	}
+
+	// Verify there aren't any cycles before walking the graph.
+	for branch := range g.parentBranches {
+		if _, err := g.ancestors(branch); err != nil {
+			return o.Err(err)
+		}
+	}
+
+	r := g.gitRunner()
+	local, err := localBranches(r, d, "")
+	if err != nil {
+		return o.Err(err)
+	}
+
+	rootSet := map[string]bool{}
+	for _, parent := range g.parentBranches {
+		if _, ok := g.parentBranches[parent]; !ok {
+			rootSet[parent] = true
+		}
+	}
+	roots := maps.Keys(rootSet)
+	slices.Sort(roots)
+
+	current := currentBranchArg.Get(d)
+	label := func(branch string) string {
+		r := branch
+		if branch == current {
+			r += " *"
+		}
+		if !local[branch] {
+			r += " (missing)"
+		}
+		return r
+	}
+
+	var printChildren func(parent, indent string) error
+	printChildren = func(parent, indent string) error {
+		children := g.children(parent)
+		for idx, child := range children {
+			connector, childIndent := "├── ", "│   "
+			if idx == len(children)-1 {
+				connector, childIndent = "└── ", "    "
+			}
+
+			line := label(child)
+			if !local[parent] {
+				line += " (parent missing)"
+			} else if local[child] {
+				ahead, behind, err := r.AheadBehind(nil, d, parent, child)
+				if err != nil {
+					return o.Annotatef(err, "failed to compare %s to %s", child, parent)
+				}
+				line += fmt.Sprintf(" [ahead %d, behind %d]", ahead, behind)
+			}
+			o.Stdoutf("%s%s%s\n", indent, connector, line)
+
+			if err := printChildren(child, indent+childIndent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, root := range roots {
+		o.Stdoutln(label(root))
+		if err := printChildren(root, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune removes stored metadata for branches, git roots, and repos that no
+// longer exist. Only the current repo's parent branch graph is checked for
+// missing branches. Children of removed branches are reattached to their
+// closest remaining ancestor.
+func (g *git) prune(o command.Output, d *command.Data) error {
+	dryRun := dryRunFlag.Get(d)
+	var summary []string
+
+	rootSet := map[string]bool{}
+	for root := range g.BranchHistory {
+		rootSet[root] = true
+	}
+	// Include the current repo, if there is one.
+	currentRoot, err := g.gitRunner().Root(nil, d)
+	inRepo := err == nil && currentRoot != ""
+	if inRepo {
+		rootSet[currentRoot] = true
+		if err := g.loadRepoParents(nil, d); err != nil {
+			return o.Err(err)
+		}
+	}
+	roots := maps.Keys(rootSet)
+	slices.Sort(roots)
+
+	// Map from git root to the branches that exist in it (nil if the git root
+	// no longer exists).
+	rootBranches := map[string]map[string]bool{}
+	for _, root := range roots {
+		if _, err := osStat(root); err != nil {
+			if _, ok := g.BranchHistory[root]; ok {
+				rootBranches[root] = nil
+				summary = append(summary, fmt.Sprintf("Removing branch history for missing directory %s", root))
+			}
+			continue
+		}
+
+		bs, err := localBranches(g.gitRunner(), d, root)
+		if err != nil {
+			return o.Annotatef(err, "failed to list branches in %s", root)
+		}
+		rootBranches[root] = bs
+		for _, v := range g.BranchHistory[root] {
+			if !bs[v.Branch] {
+				summary = append(summary, fmt.Sprintf("Removing %s from the branch history for %s", v.Branch, root))
+			}
+		}
+	}
+
+	repoIDs := maps.Keys(g.RepoParentBranches)
+	slices.Sort(repoIDs)
+	var removeRepos []string
+	for _, repoID := range repoIDs {
+		if repoID == g.repoID {
+			continue
+		}
+		if _, err := osStat(repoID); err != nil {
+			removeRepos = append(removeRepos, repoID)
+			summary = append(summary, fmt.Sprintf("Removing parent branches for missing repo %s", repoID))
+		}
+	}
+
+	for branch := range g.parentBranches {
+		if _, err := g.ancestors(branch); err != nil {
+			return o.Err(err)
+		}
+	}
+	existing := rootBranches[currentRoot]
+
+	// closestParent returns the nearest ancestor of branch that still exists,
+	// skipping over any removed branches.
+	missing := func(b string) bool { return !existing[b] }
+	closestParent := func(branch string) (string, bool) {
+		parent := g.parentBranches[branch]
+		for missing(parent) {
+			grandparent, ok := g.parentBranches[parent]
+			if !ok {
+				return "", false
+			}
+			parent = grandparent
+		}
+		return parent, true
+	}
+
+	branches := maps.Keys(g.parentBranches)
+	slices.Sort(branches)
+	if !inRepo || existing == nil {
+		// Without any repo to check against, every branch would look missing.
+		branches = nil
+	}
+	newParents := map[string]string{}
+	var removeParents []string
+	for _, branch := range branches {
+		if missing(branch) {
+			removeParents = append(removeParents, branch)
+			summary = append(summary, fmt.Sprintf("Removing parent branch entry for missing branch %s", branch))
+			continue
+		}
+
+		parent := g.parentBranches[branch]
+		if !missing(parent) {
+			continue
+		}
+		if np, ok := closestParent(branch); ok {
+			newParents[branch] = np
+			summary = append(summary, fmt.Sprintf("Reattaching %s from %s to %s", branch, parent, np))
+		} else {
+			removeParents = append(removeParents, branch)
+			summary = append(summary, fmt.Sprintf("Removing parent branch entry for %s (parent %s no longer exists)", branch, parent))
+		}
+	}
+
+	if len(summary) == 0 {
+		o.Stdoutln("Nothing to prune")
+		return nil
+	}
+	for _, line := range summary {
+		o.Stdoutln(line)
+	}
+	if dryRun {
+		o.Stdoutln("Dry run: no changes were made")
+		return nil
+	}
+
+	g.filterHistory(func(root string, v *BranchVisit) bool {
+		bs, ok := rootBranches[root]
+		return !ok || bs[v.Branch]
+	})
+	for branch, parent := range newParents {
+		g.setParentBranch(branch, parent)
+	}
+	for _, branch := range removeParents {
+		g.deleteParentBranch(branch)
+	}
+	for _, repoID := range removeRepos {
+		delete(g.RepoParentBranches, repoID)
 	}
-	g.PreviousBranches[gitRoot] = branch
 	g.changed = true
+	return nil
 }
 
-func (g *git) add(files []string) []string {
-	if len(files) == 0 {
-		return []string{"git add ."}
+// mergedBranches returns the local branches that have been merged into base,
+// mapped to whether or not the branch was squash-merged. Branches that can't be
+// checked for a squash-merge are reported to o and skipped.
+// hasOwnCommits returns whether branch (whose tip is the provided commit) has
+// any commits of its own. Branches without any (e.g. ones that were just
+// created) are trivially merged into their parent, even after the parent
+// advances. Unlike a branch that was merged into its parent, their tip is the
+// merge-base with the parent and is in the parent's first-parent history.
+func hasOwnCommits(r GitRunner, d *command.Data, parent, branch, tip string) (bool, error) {
+	mb, err := r.MergeBase(nil, d, parent, branch)
+	if err != nil {
+		return false, fmt.Errorf("failed to get merge base for %s: %v", branch, err)
+	}
+	if mb != tip {
+		return true, nil
+	}
+	forked, err := r.FirstParentContains(nil, d, parent, tip)
+	if err != nil {
+		return false, fmt.Errorf("failed to get first-parent history of %s: %v", parent, err)
+	}
+	return !forked, nil
+}
+
+func mergedBranches(r GitRunner, o command.Output, d *command.Data, base string, branches []string) (map[string]bool, error) {
+	merged, err := r.MergedBranches(nil, d, base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merged branches: %v", err)
+	}
+
+	m := map[string]bool{}
+	for _, b := range merged {
+		m[b] = false
+	}
+
+	for _, b := range branches {
+		if _, ok := m[b]; ok {
+			continue
+		}
+		squashed, err := r.SquashMerged(nil, d, base, b)
+		if err != nil {
+			o.Stderrf("%v\n", err)
+			continue
+		}
+		if squashed {
+			m[b] = true
+		}
+	}
+	return m, nil
+}
+
+// parentMergeBase returns the merge-base of the current branch and its parent
+// branch.
+func (g *git) parentMergeBase(o command.Output, d *command.Data) (string, error) {
+	branch, err := g.gitRunner().CurrentBranch(nil, d)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current branch: %v", err)
+	}
+	if err := g.loadRepoParents(o, d); err != nil {
+		return "", err
+	}
+	parent, ok := g.parentBranches[branch]
+	if !ok {
+		return "", fmt.Errorf("branch %s does not have a known parent branch", branch)
+	}
+	mb, err := g.gitRunner().MergeBase(nil, d, parent, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get merge base of %s and %s: %v", branch, parent, err)
+	}
+	return mb, nil
+}
+
+// commitArgs returns the `git commit` args for the message arg.
+func commitArgs(d *command.Data) []string {
+	args := []string{"commit"}
+	if nvFlag.Get(d) != "" {
+		args = append(args, nvFlag.Get(d))
+	}
+	return append(args, "-m", strings.Join(messageArg.Get(d), " "))
+}
+
+// squash soft-resets the current branch to its merge-base with its parent
+// branch (or the default branch if no parent is recorded) and recommits all of
+// the changes as a single commit.
+func (g *git) squash(o command.Output, d *command.Data) (*execution, error) {
+	branch := currentBranchArg.Get(d)
+	base, ok := g.parentBranches[branch]
+	if !ok {
+		base = g.GetDefaultBranch(d)
+	}
+
+	mb, err := g.gitRunner().MergeBase(nil, d, base, "HEAD")
+	if err != nil {
+		return nil, o.Annotatef(err, "failed to get merge base of %s and %s", branch, base)
+	}
+
+	e := &execution{
+		git: [][]string{
+			{"reset", "--soft", mb},
+			commitArgs(d),
+		},
+		success: "Success!",
+	}
+	if pushFlag.Get(d) {
+		// The branch's history was rewritten, so a regular push would be rejected
+		// if the branch was already pushed.
+		e.git = append(e.git, []string{"push", "--force-with-lease"})
+	}
+	return e, nil
+}
+
+// mergeMain merges the default branch (or the current branch's parent branch
+// if `--parent` is provided) into the current branch.
+func (g *git) mergeMain(o command.Output, d *command.Data) (*execution, error) {
+	var branch string
+	if mmParentFlag.Get(d) {
+		currentBranch, err := g.gitRunner().CurrentBranch(nil, d)
+		if err != nil {
+			return nil, o.Annotatef(err, "failed to get current branch")
+		}
+		if err := g.loadRepoParents(o, d); err != nil {
+			return nil, o.Err(err)
+		}
+		parent, ok := g.parentBranches[currentBranch]
+		if !ok {
+			return nil, o.Stderrf("branch %s does not have a known parent branch\n", currentBranch)
+		}
+		branch = parent
+	} else {
+		branch = g.GetDefaultBranch(d)
+	}
+
+	var cmds [][]string
+	if mmFetchFlag.Get(d) {
+		cmds = append(cmds, []string{"fetch", "origin", branch})
+		branch = fmt.Sprintf("origin/%s", branch)
+	}
+	if mmRebaseFlag.Get(d) {
+		cmds = append(cmds, []string{"rebase", branch})
+	} else {
+		cmds = append(cmds, []string{"merge", branch})
+	}
+	return gitExecution(cmds...), nil
+}
+
+func (g *git) cleanup(o command.Output, d *command.Data) (*execution, error) {
+	base := g.GetDefaultBranch(d)
+
+	r := g.gitRunner()
+	branches, err := r.Branches(nil, d, "")
+	if err != nil {
+		return nil, o.Annotatef(err, "failed to get git branches")
+	}
+	tips, err := r.BranchTips(nil, d)
+	if err != nil {
+		return nil, o.Annotatef(err, "failed to get git branches")
+	}
+	var candidates []string
+	for _, b := range branches {
+		// Branches that are checked out (here or in another worktree) can't be
+		// deleted.
+		if b.Name != base && !b.Current && !b.Worktree {
+			candidates = append(candidates, b.Name)
+		}
+	}
+	slices.Sort(candidates)
+
+	merged, err := mergedBranches(r, o, d, base, candidates)
+	if err != nil {
+		return nil, o.Err(err)
+	}
+
+	var toDelete []string
+	for _, b := range candidates {
+		if _, ok := merged[b]; !ok {
+			continue
+		}
+		parent, ok := g.parentBranches[b]
+		if _, exists := tips[parent]; !ok || !exists {
+			parent = base
+		}
+		ownCommits, err := hasOwnCommits(r, d, parent, b, tips[b])
+		if err != nil {
+			o.Stderrf("%v\n", err)
+			continue
+		}
+		if ownCommits {
+			toDelete = append(toDelete, b)
+		}
+	}
+	if len(toDelete) == 0 {
+		o.Stdoutf("No branches have been merged into %s\n", base)
+		return nil, nil
+	}
+
+	o.Stdoutf("Deleting branches merged into %s:\n", base)
+	for _, b := range toDelete {
+		var details []string
+		if merged[b] {
+			details = append(details, "squash-merged")
+		}
+		if parent, ok := g.parentBranches[b]; ok {
+			details = append(details, fmt.Sprintf("parent: %s", parent))
+		}
+		if len(details) > 0 {
+			o.Stdoutf("  %s (%s)\n", b, strings.Join(details, ", "))
+		} else {
+			o.Stdoutf("  %s\n", b)
+		}
+	}
+
+	roots, err := g.repoHistoryRoots(d)
+	if err != nil {
+		return nil, o.Err(err)
+	}
+	for _, b := range toDelete {
+		g.removeBranch(b, roots)
 	}
-	return []string{fmt.Sprintf("git add %s", strings.Join(files, " "))}
+	// Squash-merged branches aren't considered merged by git, hence the -D.
+	return gitExecution(append([]string{"branch", "-D"}, toDelete...)), nil
 }
@@ -1,11 +1,15 @@
 package sourcecontrol
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/leep-frog/command/command"
 	"github.com/leep-frog/command/commander"
@@ -27,6 +31,52 @@ func repoRunContents() *commandtest.RunContents {
 	}
 }
 
+var (
+	fakeNow    = time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC)
+	fakeRepoID = "/git/root/.git"
+)
+
+// nameStatus returns `git diff --name-status -z` output for the provided
+// modified files.
+func nameStatus(files ...string) string {
+	var r []string
+	for _, f := range files {
+		r = append(r, "M", f)
+	}
+	return strings.Join(r, "\x00") + "\x00"
+}
+
+func repoIDRunContents() *commandtest.RunContents {
+	return &commandtest.RunContents{
+		Name: "git",
+		Args: []string{
+			"rev-parse",
+			"--path-format=absolute",
+			"--git-common-dir",
+		},
+	}
+}
+
+// branchVisits returns n history entries for branches b0, b1, ..., b{n-1}.
+func branchVisits(n int) []*BranchVisit {
+	var r []*BranchVisit
+	for i := 0; i < n; i++ {
+		r = append(r, &BranchVisit{Branch: fmt.Sprintf("b%d", i)})
+	}
+	return r
+}
+
+func remoteHeadRunContents() *commandtest.RunContents {
+	return &commandtest.RunContents{
+		Name: "git",
+		Args: []string{
+			"symbolic-ref",
+			"--short",
+			"refs/remotes/origin/HEAD",
+		},
+	}
+}
+
 func TestExecution(t *testing.T) {
 	type osCheck struct {
 		wantExecutable []string
@@ -55,18 +105,36 @@ func TestExecution(t *testing.T) {
 		`┣━━ cfg ┓`,
 		`┃   ┏━━━┛`,
 		`┃   ┃`,
-		`┃   ┗━━ main ┓`,
-		`┃       ┏━━━━┛`,
-		`┃       ┃`,
-		`┃       ┣━━ set DEFAULT_BRANCH --global|-g`,
-		`┃       ┃`,
-		`┃       ┣━━ show`,
-		`┃       ┃`,
-		`┃       ┗━━ unset --global|-g`,
+		`┃   ┣━━ host ┓`,
+		`┃   ┃   ┏━━━━┛`,
+		`┃   ┃   ┃`,
+		`┃   ┃   ┣━━ set HOST HOST_TYPE`,
+		`┃   ┃   ┃`,
+		`┃   ┃   ┣━━ show`,
+		`┃   ┃   ┃`,
+		`┃   ┃   ┗━━ unset HOST`,
+		`┃   ┃`,
+		`┃   ┣━━ main ┓`,
+		`┃   ┃   ┏━━━━┛`,
+		`┃   ┃   ┃`,
+		`┃   ┃   ┣━━ set DEFAULT_BRANCH --global|-g`,
+		`┃   ┃   ┃`,
+		`┃   ┃   ┣━━ show`,
+		`┃   ┃   ┃`,
+		`┃   ┃   ┗━━ unset --global|-g`,
+		`┃   ┃`,
+		`┃   ┃   Remove metadata for branches and directories that no longer exist`,
+		`┃   ┗━━ prune`,
 		`┃`,
 		`┃   Checkout new branch`,
 		`┣━━ ch BRANCH --new-branch|-n`,
 		`┃`,
+		`┃   Delete local branches that have been merged into the default branch`,
+		`┣━━ cleanup`,
+		`┃`,
+		`┃   List files with merge conflicts`,
+		`┣━━ conflicts`,
+		`┃`,
 		`┃   Commit and push`,
 		`┣━━ cp MESSAGE [ MESSAGE ... ] --no-verify|-n`,
 		`┃`,
@@ -74,14 +142,17 @@ func TestExecution(t *testing.T) {
 		`┣━━ current --format|-f FORMAT --ignore-no-branch|-i --parent-format|-F PARENT_FORMAT --prefix|-p PREFIX --suffix|-s SUFFIX`,
 		`┃`,
 		`┃   Diff`,
-		`┣━━ d [ FILE ... ] --main|-m --commit|-c --whitespace|-w --add|-a`,
+		`┣━━ d [ FILE ... ] --main|-m --commit|-c --parent|-P --stat|-s --name-only|-n --whitespace|-w --add|-a`,
 		`┃`,
 		`┃   End a branch after it has been merged`,
-		`┣━━ end`,
+		`┣━━ end --force-delete|-f --restack|-r`,
 		`┃`,
 		`┃   Git fetch`,
 		`┣━━ f`,
 		`┃`,
+		`┃   List recently checked out branches`,
+		`┣━━ hist`,
+		`┃`,
 		`┃   Pull`,
 		`┣━━ [l|pl]`,
 		`┃`,
@@ -92,22 +163,31 @@ func TestExecution(t *testing.T) {
 		`┣━━ m`,
 		`┃`,
 		`┃   Merge main`,
-		`┣━━ mm`,
+		`┣━━ mm --fetch|-f --rebase|-r --parent|-p`,
+		`┃`,
+		`┃   Rename a branch and its recorded metadata`,
+		`┣━━ mv OLD_BRANCH NEW_BRANCH`,
 		`┃`,
 		`┃   Git stash pop`,
 		`┣━━ op [ STASH_ARGS ... ]`,
 		`┃`,
+		`┃   Resolve conflicts by taking our version of the files`,
+		`┣━━ ours FILES [ FILES ... ]`,
+		`┃`,
 		`┃   Push`,
 		`┣━━ p --upstream|-u`,
 		`┃`,
 		`┃   Checkout previous branch`,
-		`┣━━ pb`,
+		`┣━━ pb [ N ]`,
 		`┃`,
 		`┃   Pull and push`,
 		`┣━━ pp`,
 		`┃`,
 		`┃   Get PR link`,
-		`┣━━ pr-link`,
+		`┣━━ pr-link --base|-b BASE --stack|-s --markdown|-m`,
+		`┃`,
+		`┃   Squash the current branch's commits into a single commit`,
+		`┣━━ q MESSAGE [ MESSAGE ... ] --no-verify|-n --push|-p`,
 		`┃`,
 		`┣━━ rb ┓`,
 		`┃   ┏━━┛`,
@@ -116,7 +196,16 @@ func TestExecution(t *testing.T) {
 		`┃   ┣━━ a`,
 		`┃   ┃`,
 		`┃   ┃   Continue`,
-		`┃   ┗━━ c`,
+		`┃   ┣━━ c`,
+		`┃   ┃`,
+		`┃   ┃   Skip`,
+		`┃   ┗━━ s`,
+		`┃`,
+		`┃   Change the recorded parent of a branch`,
+		`┣━━ reparent BRANCH [ BRANCH ] --rebase|-r`,
+		`┃`,
+		`┃   Rebase (or merge) every branch in the current stack onto its updated parent`,
+		`┣━━ restack --merge|-m --continue|-c`,
 		`┃`,
 		`┃   Remove`,
 		`┣━━ rm FILES [ FILES ... ]`,
@@ -127,6 +216,12 @@ func TestExecution(t *testing.T) {
 		`┃   Create ssh-agent`,
 		`┣━━ sh`,
 		`┃`,
+		`┃   Resolve conflicts by taking their version of the files`,
+		`┣━━ theirs FILES [ FILES ... ]`,
+		`┃`,
+		`┃   Display the parent branch graph`,
+		`┣━━ tree`,
+		`┃`,
 		`┃   Undo add`,
 		`┣━━ ua [ FILE ... ]`,
 		`┃`,
@@ -137,27 +232,54 @@ func TestExecution(t *testing.T) {
 		`┣━━ uco`,
 		`┃`,
 		`┃   Push upstream and output PR link`,
-		`┣━━ up`,
+		`┣━━ up --base|-b BASE`,
 		`┃`,
 		`┃   Git stash push`,
-		`┗━━ ush [ STASH_ARGS ... ]`,
+		`┣━━ ush [ STASH_ARGS ... ]`,
+		`┃`,
+		`┗━━ wt ┓`,
+		`    ┏━━┛`,
+		`    ┃`,
+		`    ┃   Create a worktree for a branch and cd into it`,
+		`    ┣━━ add BRANCH [ PATH ] --new-branch|-n`,
+		`    ┃`,
+		`    ┃   cd into the worktree for a branch`,
+		`    ┣━━ cd BRANCH`,
+		`    ┃`,
+		`    ┃   List worktrees`,
+		`    ┣━━ ls`,
+		`    ┃`,
+		`    ┃   Remove a worktree`,
+		`    ┗━━ rm BRANCH --force|-f`,
 		``,
 		`Arguments:`,
 		`  BRANCH: Branch`,
 		`  DEFAULT_BRANCH: Default branch for this git repo`,
 		`  FILE: Files to un-change`,
 		`  FILES: Files to add`,
+		`  HOST: Hostname of the git remote`,
+		`  HOST_TYPE: Type of git host`,
 		`  MESSAGE: Commit message`,
+		`  N: Number of entries to go back in the branch history`,
+		`    Positive()`,
+		`    Default: 1`,
 		`  N: Number of git logs to display`,
 		`    Default: 1`,
 		`    NonNegative()`,
+		`  NEW_BRANCH: New branch name`,
+		`  OLD_BRANCH: Branch to rename`,
+		`  PATH: Directory to create the worktree in (defaults to a sibling of the main worktree)`,
 		"  STASH_ARGS: Args to pass to `git stash push/pop`",
 		``,
 		`Flags:`,
 		`  [a] add: If set, then files will be added`,
+		`  [b] base: Branch to open the PR against`,
 		`  [c] commit: Whether to diff against the previous commit`,
+		`  [c] continue: Continue a restack after resolving conflicts`,
 		`  [d] diff: Whether or not to diff the current changes against N commits prior`,
 		`  [y] dry-run: Dry-run mode`,
+		`  [f] fetch: Fetch the branch from origin first and merge origin/<branch>`,
+		`  [f] force: Remove the worktree even if it has uncommitted changes`,
 		`  [f] force-delete: force delete the branch`,
 		`  [f] format: Golang format for the branch`,
 		`    Default: %s`,
@@ -165,24 +287,42 @@ func TestExecution(t *testing.T) {
 		`  [g] global: Whether or not to change the global setting`,
 		`  [i] ignore-no-branch: Ignore any errors in the git branch command`,
 		`  [m] main: Whether to diff against main branch or just local diffs`,
+		`  [m] markdown: Output the stack PR links as a markdown table`,
+		`  [m] merge: Merge each parent into its child instead of rebasing`,
+		`  [n] name-only: Whether to only show the names of changed files`,
 		`  [n] new-branch: Whether or not to checkout a new branch`,
 		`  [n] no-verify: Whether or not to run pre-commit checks`,
+		`  [P] parent: Whether to diff against the merge-base with the current branch's parent branch`,
+		`  [p] parent: Merge the current branch's parent branch instead of the default branch`,
 		`  [F] parent-format: Golang format for the the parent branches`,
 		`  [p] prefix: Prefix to include if a branch is detected`,
 		`  [p] push: Whether or not to push afterwards`,
+		`  [r] rebase: Rebase the branch onto its new parent`,
+		`  [r] rebase: Rebase onto the branch instead of merging it`,
+		`  [r] restack: Rebase child branches onto the ended branch's parent`,
+		`  [s] stack: Output PR links for every branch in the current stack`,
+		`  [s] stat: Whether to only show the diffstat`,
 		`  [s] suffix: Suffix to include if a branch is detected`,
 		`  [u] upstream: If set, push branch to upstream`,
 		`  [w] whitespace: Whether or not to show whitespace in diffs`,
 	}, "\n")
 	_ = u
 
-	for _, curOS := range []sourcerer.OS{sourcerer.Linux(), sourcerer.Windows()} {
+	oses := []sourcerer.OS{
+		sourcerer.Linux(),
+		sourcerer.Windows(),
+		// Other OSes that use a POSIX shell should behave just like linux.
+		(&fakeOS{sourcerer.Linux(), "darwin"}).os(),
+		(&fakeOS{sourcerer.Linux(), "freebsd"}).os(),
+	}
+	for _, curOS := range oses {
 		for _, test := range []struct {
-			name     string
-			g        *git
-			want     *git
-			etc      *commandtest.ExecuteTestCase
-			osChecks map[string]*osCheck
+			name       string
+			g          *git
+			want       *git
+			wantLegacy map[string]string
+			etc        *commandtest.ExecuteTestCase
+			osChecks   map[string]*osCheck
 		}{
 			// TODO: Config tests
 			// Simple command tests
@@ -270,7 +410,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							"git diff HEAD~1 ",
+							"git diff HEAD~1",
 						},
 					},
 				},
@@ -285,7 +425,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							"git diff HEAD~7 ",
+							"git diff HEAD~7",
 						},
 					},
 				},
@@ -329,7 +469,7 @@ func TestExecution(t *testing.T) {
 					Args: []string{"ush"},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							"git stash push ",
+							"git stash push",
 						},
 					},
 				},
@@ -340,7 +480,7 @@ func TestExecution(t *testing.T) {
 					Args: []string{"op"},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							"git stash pop ",
+							"git stash pop",
 						},
 					},
 				},
@@ -350,11 +490,11 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"ush", "abc", "123"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						stashArgs.Name(): []string{"abc", "123"},
+						"STASH_ARGS": []string{"abc", "123"},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git stash push "abc" "123"`,
+							`git stash push abc 123`,
 						},
 					},
 				},
@@ -364,11 +504,11 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"op", "def", "456"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						stashArgs.Name(): []string{"def", "456"},
+						"STASH_ARGS": []string{"def", "456"},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git stash pop "def" "456"`,
+							`git stash pop def 456`,
 						},
 					},
 				},
@@ -447,6 +587,7 @@ func TestExecution(t *testing.T) {
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/some/git/root",
 						currentBranchArg.ArgName: "current-branch",
+						pbArg.Name():             1,
 					}},
 					WantErr:    fmt.Errorf("no previous branch exists"),
 					WantStderr: "no previous branch exists\n",
@@ -455,9 +596,9 @@ func TestExecution(t *testing.T) {
 			{
 				name: "previous branch works",
 				g: &git{
-					PreviousBranches: map[string]string{
-						"/some/git/root":       "old-branch",
-						"/some/git/other-root": "other-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/root":       {{Branch: "old-branch"}},
+						"/some/git/other-root": {{Branch: "other-branch"}},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
@@ -483,6 +624,7 @@ func TestExecution(t *testing.T) {
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/some/git/root",
 						currentBranchArg.ArgName: "current-branch",
+						pbArg.Name():             1,
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
@@ -491,10 +633,129 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/some/git/root":       "current-branch",
-						"/some/git/other-root": "other-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/root":       {{Branch: "current-branch", Time: fakeNow}},
+						"/some/git/other-root": {{Branch: "other-branch"}},
+					},
+				},
+			},
+			{
+				name: "previous branch goes back N entries",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/root": {
+							{Branch: "one", Time: fakeNow.Add(-time.Minute)},
+							{Branch: "two", Time: fakeNow.Add(-time.Hour)},
+							{Branch: "three"},
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pb", "2"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/some/git/root"}},
+						{Stdout: []string{"current-branch"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/some/git/root",
+						currentBranchArg.ArgName: "current-branch",
+						pbArg.Name():             2,
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git checkout two`,
+						},
+					},
+				},
+				want: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/root": {
+							{Branch: "current-branch", Time: fakeNow},
+							{Branch: "one", Time: fakeNow.Add(-time.Minute)},
+							{Branch: "three"},
+						},
+					},
+				},
+			},
+			{
+				name: "previous branch fails if N is larger than the history",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/root": {{Branch: "one"}, {Branch: "two"}},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pb", "3"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/some/git/root"}},
+						{Stdout: []string{"current-branch"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/some/git/root",
+						currentBranchArg.ArgName: "current-branch",
+						pbArg.Name():             3,
+					}},
+					WantStderr: "only 2 previous branch(es) exist\n",
+					WantErr:    fmt.Errorf("only 2 previous branch(es) exist"),
+				},
+			},
+			// Branch history
+			{
+				name: "history lists recent branches",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/root": {
+							{Branch: "one", Time: fakeNow},
+							{Branch: "two"},
+						},
+						"/some/git/other-root": {{Branch: "other"}},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"hist"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/some/git/root"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName: "/some/git/root",
+					}},
+					WantStdout: strings.Join([]string{
+						"1: one (2026-03-04 05:06:07)",
+						"2: two (unknown time)",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "history with no entries",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/some/git/other-root": {{Branch: "other"}},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"hist"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/some/git/root"}},
 					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName: "/some/git/root",
+					}},
+					WantStdout: "No branch history for this repo\n",
 				},
 			},
 			// Checkout main
@@ -506,11 +767,13 @@ func TestExecution(t *testing.T) {
 						{Stdout: []string{"/git/root"}},
 						{Stdout: []string{"current-branch"}},
 						{Stdout: []string{"test-repo"}},
+						{Err: fmt.Errorf("not a symbolic ref")},
 					},
 					WantRunContents: []*commandtest.RunContents{
 						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 						repoRunContents(),
+						remoteHeadRunContents(),
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
@@ -524,8 +787,8 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "current-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -540,11 +803,13 @@ func TestExecution(t *testing.T) {
 						{Stdout: []string{"/git/root"}},
 						{Stdout: []string{"current-branch"}},
 						{Stdout: []string{"test-repo"}},
+						{Err: fmt.Errorf("not a symbolic ref")},
 					},
 					WantRunContents: []*commandtest.RunContents{
 						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 						repoRunContents(),
+						remoteHeadRunContents(),
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
@@ -559,8 +824,133 @@ func TestExecution(t *testing.T) {
 				},
 				want: &git{
 					MainBranches: map[string]string{},
-					PreviousBranches: map[string]string{
-						"/git/root": "current-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
+					},
+				},
+			},
+			{
+				name: "checkout main detects default branch from remote HEAD",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"m"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Stdout: []string{"current-branch"}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"origin/master"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+						remoteHeadRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/git/root",
+						currentBranchArg.ArgName: "current-branch",
+						repoUrl.Name():           "test-repo",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git checkout master",
+						},
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"test-repo": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"test-repo": true,
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
+					},
+				},
+			},
+			{
+				name: "checkout main detects default branch from local remote",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"m"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Stdout: []string{"current-branch"}},
+						{Stdout: []string{"/some/bare/repo.git"}},
+						{Err: fmt.Errorf("not a symbolic ref")},
+						{Stdout: []string{"ref: refs/heads/develop\tHEAD", "abc123\tHEAD"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+						remoteHeadRunContents(),
+						{Name: "git", Args: []string{"ls-remote", "--symref", "origin", "HEAD"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/git/root",
+						currentBranchArg.ArgName: "current-branch",
+						repoUrl.Name():           "/some/bare/repo.git",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git checkout develop",
+						},
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"/some/bare/repo.git": "develop",
+					},
+					DetectedMainBranches: map[string]bool{
+						"/some/bare/repo.git": true,
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
+					},
+				},
+			},
+			{
+				name: "checkout main uses cached detected default branch",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"test-repo": true,
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"m"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Stdout: []string{"current-branch"}},
+						{Stdout: []string{"test-repo"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/git/root",
+						currentBranchArg.ArgName: "current-branch",
+						repoUrl.Name():           "test-repo",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git checkout master",
+						},
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"test-repo": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"test-repo": true,
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -594,8 +984,8 @@ func TestExecution(t *testing.T) {
 				},
 				want: &git{
 					DefaultBranch: "mainer",
-					PreviousBranches: map[string]string{
-						"/git/root": "current-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -631,8 +1021,8 @@ func TestExecution(t *testing.T) {
 				want: &git{
 					MainBranches:  map[string]string{},
 					DefaultBranch: "mainer",
-					PreviousBranches: map[string]string{
-						"/git/root": "current-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -672,8 +1062,8 @@ func TestExecution(t *testing.T) {
 					MainBranches: map[string]string{
 						"test-repo": "mainest",
 					},
-					PreviousBranches: map[string]string{
-						"/git/root": "current-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "current-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -682,10 +1072,14 @@ func TestExecution(t *testing.T) {
 				name: "merge main",
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"mm"},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"test-repo"},
-					}},
-					WantRunContents: []*commandtest.RunContents{repoRunContents()},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Err: fmt.Errorf("not a symbolic ref")},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						remoteHeadRunContents(),
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						repoUrl.Name(): "test-repo",
 					}},
@@ -741,38 +1135,260 @@ func TestExecution(t *testing.T) {
 					},
 				},
 			},
-			// Push and pull
 			{
-				name: "push",
-				etc: &commandtest.ExecuteTestCase{
-					Args:            []string{"p"},
-					WantExecuteData: &command.ExecuteData{Executable: []string{"", "git push"}, FunctionWrap: true},
+				name: "merge main fetches first",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "mainest",
+					},
 				},
-			},
-			{
-				name: "push upstream fails if can't get branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"p", "--upstream"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
+					Args: []string{"mm", "-f"},
 					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-						Err:    fmt.Errorf("failed to get some-branch"),
+						Stdout: []string{"test-repo"},
 					}},
-					WantStderr: "failed to execute shell command: failed to get some-branch\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: failed to get some-branch"),
+					WantRunContents: []*commandtest.RunContents{repoRunContents()},
 					WantData: &command.Data{Values: map[string]interface{}{
-						pushUpstreamFlag.Name(): true,
+						mmFetchFlag.Name(): true,
+						repoUrl.Name():     "test-repo",
 					}},
 				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git fetch origin mainest && git merge origin/mainest",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git fetch origin mainest"),
+							wCmd("git merge origin/mainest"),
+						},
+					},
+				},
 			},
 			{
-				name: "push upstream succeeds",
+				name: "merge main rebases",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "mainest",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"mm", "-r"},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"test-repo"},
+					}},
+					WantRunContents: []*commandtest.RunContents{repoRunContents()},
+					WantData: &command.Data{Values: map[string]interface{}{
+						mmRebaseFlag.Name(): true,
+						repoUrl.Name():      "test-repo",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git rebase mainest",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							"git rebase mainest",
+						},
+					},
+				},
+			},
+			{
+				name: "merge main fetches and rebases",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "mainest",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"mm", "-f", "-r"},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"test-repo"},
+					}},
+					WantRunContents: []*commandtest.RunContents{repoRunContents()},
+					WantData: &command.Data{Values: map[string]interface{}{
+						mmFetchFlag.Name():  true,
+						mmRebaseFlag.Name(): true,
+						repoUrl.Name():      "test-repo",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git fetch origin mainest && git rebase origin/mainest",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git fetch origin mainest"),
+							wCmd("git rebase origin/mainest"),
+						},
+					},
+				},
+			},
+			{
+				name: "merge main merges parent branch",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "mainest",
+					},
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child": "parent",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"mm", "-p"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						mmParentFlag.Name(): true,
+						repoUrl.Name():      "test-repo",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git merge parent",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							"git merge parent",
+						},
+					},
+				},
+			},
+			{
+				name: "merge main fetches and rebases onto parent branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child": "parent",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"mm", "-p", "-f", "-r"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						mmFetchFlag.Name():  true,
+						mmRebaseFlag.Name(): true,
+						mmParentFlag.Name(): true,
+						repoUrl.Name():      "test-repo",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git fetch origin parent && git rebase origin/parent",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git fetch origin parent"),
+							wCmd("git rebase origin/parent"),
+						},
+					},
+				},
+			},
+			{
+				name: "merge main fails if no parent branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"mm", "-p"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						mmParentFlag.Name(): true,
+						repoUrl.Name():      "test-repo",
+					}},
+					WantStderr: "branch child does not have a known parent branch\n",
+					WantErr:    fmt.Errorf("branch child does not have a known parent branch"),
+				},
+			},
+			{
+				name: "merge main fails if current branch check fails",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"mm", "-p"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Err: fmt.Errorf("oops")},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						mmParentFlag.Name(): true,
+						repoUrl.Name():      "test-repo",
+					}},
+					WantStderr: "failed to get current branch: failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to get current branch: failed to execute shell command: oops"),
+				},
+			},
+			// Push and pull
+			{
+				name: "push",
+				etc: &commandtest.ExecuteTestCase{
+					Args:            []string{"p"},
+					WantExecuteData: &command.ExecuteData{Executable: []string{"", "git push"}, FunctionWrap: true},
+				},
+			},
+			{
+				name: "push upstream fails if can't get branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"p", "--upstream"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-branch"},
+						Err:    fmt.Errorf("failed to get some-branch"),
+					}},
+					WantStderr: "failed to execute shell command: failed to get some-branch\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: failed to get some-branch"),
+					WantData: &command.Data{Values: map[string]interface{}{
+						pushUpstreamFlag.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "push upstream succeeds",
 				etc: &commandtest.ExecuteTestCase{
 					Args:            []string{"p", "--upstream"},
-					WantExecuteData: &command.ExecuteData{Executable: []string{"", `git push --set-upstream origin "some-branch"`}, FunctionWrap: true},
+					WantExecuteData: &command.ExecuteData{Executable: []string{"", `git push --set-upstream origin some-branch`}, FunctionWrap: true},
 					WantRunContents: []*commandtest.RunContents{{
 						Name: "git",
 						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
@@ -784,7 +1400,7 @@ func TestExecution(t *testing.T) {
 						pushUpstreamFlag.Name(): true,
 						"CURRENT_BRANCH":        "some-branch",
 					}},
-					WantStdout: "git push --set-upstream origin \"some-branch\"\n",
+					WantStdout: "git push --set-upstream origin some-branch\n",
 				},
 			},
 			{
@@ -830,7 +1446,7 @@ func TestExecution(t *testing.T) {
 				osChecks: map[string]*osCheck{
 					"windows": {
 						wantExecutable: []string{
-							wCmd(`git commit -m "did things"`),
+							wCmd(`git commit -m 'did things'`),
 							wCmd("echo Success!"),
 						},
 					},
@@ -842,7 +1458,29 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git commit -m "did things" && echo Success!`,
+							`git commit -m 'did things' && echo Success!`,
+						},
+					},
+				},
+			},
+			{
+				name: "commit message with shell characters",
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git commit -m 'it''s $HOME `whoami`'"),
+							wCmd("echo Success!"),
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"c", "it's", "$HOME", "`whoami`"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						messageArg.Name(): []string{"it's", "$HOME", "`whoami`"},
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git commit -m 'it'\\''s $HOME `whoami`' && echo Success!",
 						},
 					},
 				},
@@ -852,7 +1490,7 @@ func TestExecution(t *testing.T) {
 				osChecks: map[string]*osCheck{
 					"windows": {
 						wantExecutable: []string{
-							wCmd(`git commit --no-verify -m "did things"`),
+							wCmd(`git commit --no-verify -m 'did things'`),
 							wCmd("echo Success!"),
 						},
 					},
@@ -865,7 +1503,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git commit --no-verify -m "did things" && echo Success!`,
+							`git commit --no-verify -m 'did things' && echo Success!`,
 						},
 					},
 				},
@@ -876,7 +1514,7 @@ func TestExecution(t *testing.T) {
 					"windows": {
 						wantExecutable: []string{
 							createSSHAgentCommand,
-							wCmd(`git commit -m "did things"`),
+							wCmd(`git commit -m 'did things'`),
 							wCmd(`git push`),
 							wCmd("echo Success!"),
 						},
@@ -892,7 +1530,7 @@ func TestExecution(t *testing.T) {
 						FunctionWrap: true,
 						Executable: []string{
 							createSSHAgentCommand,
-							`git commit -m "did things" && git push && echo Success!`,
+							`git commit -m 'did things' && git push && echo Success!`,
 						},
 					},
 				},
@@ -903,7 +1541,7 @@ func TestExecution(t *testing.T) {
 					"windows": {
 						wantExecutable: []string{
 							createSSHAgentCommand,
-							wCmd(`git commit --no-verify -m "did things"`),
+							wCmd(`git commit --no-verify -m 'did things'`),
 							wCmd(`git push`),
 							wCmd("echo Success!"),
 						},
@@ -920,7 +1558,7 @@ func TestExecution(t *testing.T) {
 						FunctionWrap: true,
 						Executable: []string{
 							createSSHAgentCommand,
-							`git commit --no-verify -m "did things" && git push && echo Success!`,
+							`git commit --no-verify -m 'did things' && git push && echo Success!`,
 						},
 					},
 				},
@@ -931,7 +1569,7 @@ func TestExecution(t *testing.T) {
 					"windows": {
 						wantExecutable: []string{
 							createSSHAgentCommand,
-							wCmd(`git commit --no-verify -m "did things"`),
+							wCmd(`git commit --no-verify -m 'did things'`),
 							wCmd(`git push`),
 							wCmd("echo Success!"),
 						},
@@ -948,7 +1586,7 @@ func TestExecution(t *testing.T) {
 						FunctionWrap: true,
 						Executable: []string{
 							createSSHAgentCommand,
-							`git commit --no-verify -m "did things" && git push && echo Success!`,
+							`git commit --no-verify -m 'did things' && git push && echo Success!`,
 						},
 					},
 				},
@@ -959,10 +1597,10 @@ func TestExecution(t *testing.T) {
 					"windows": {
 						wantExecutable: []string{
 							wCmd(strings.Join([]string{
-								`git commit -m "did`,
+								`git commit -m 'did`,
 								`things and`,
 								``,
-								`other things too"`,
+								`other things too'`,
 							}, "\n")),
 							wCmd("echo Success!"),
 						},
@@ -976,10 +1614,10 @@ func TestExecution(t *testing.T) {
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
 							strings.Join([]string{
-								`git commit -m "did`,
+								`git commit -m 'did`,
 								`things and`,
 								``,
-								`other things too" && echo Success!`,
+								`other things too' && echo Success!`,
 							}, "\n"),
 						},
 					},
@@ -1000,7 +1638,7 @@ func TestExecution(t *testing.T) {
 					"windows": {
 						wantExecutable: []string{
 							createSSHAgentCommand,
-							wCmd(`git commit -m "did things"`),
+							wCmd(`git commit -m 'did things'`),
 							wCmd(`git push`),
 							wCmd("echo Success!"),
 						},
@@ -1015,7 +1653,7 @@ func TestExecution(t *testing.T) {
 						FunctionWrap: true,
 						Executable: []string{
 							createSSHAgentCommand,
-							`git commit -m "did things" && git push && echo Success!`,
+							`git commit -m 'did things' && git push && echo Success!`,
 						},
 					},
 				},
@@ -1026,7 +1664,7 @@ func TestExecution(t *testing.T) {
 					"windows": {
 						wantExecutable: []string{
 							createSSHAgentCommand,
-							wCmd(`git commit --no-verify -m "did things"`),
+							wCmd(`git commit --no-verify -m 'did things'`),
 							wCmd(`git push`),
 							wCmd("echo Success!"),
 						},
@@ -1042,74 +1680,243 @@ func TestExecution(t *testing.T) {
 						FunctionWrap: true,
 						Executable: []string{
 							createSSHAgentCommand,
-							`git commit --no-verify -m "did things" && git push && echo Success!`,
+							`git commit --no-verify -m 'did things' && git push && echo Success!`,
 						},
 					},
 				},
 			},
-			// Checkout new branch
+			// Squash
 			{
-				name: "checkout branch requires git root",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"ch"},
-					WantRunContents: []*commandtest.RunContents{
-						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+				name: "squash onto parent branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"feature": "parent",
+						},
 					},
-					RunResponses: []*commandtest.FakeRun{
-						{Err: fmt.Errorf("oh no")},
+				},
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git reset --soft abc123"),
+							wCmd(`git commit -m 'did things'`),
+							wCmd("echo Success!"),
+						},
 					},
-					WantStderr: "failed to execute shell command: oh no\n",
-					WantErr:    fmt.Errorf(`failed to execute shell command: oh no`),
 				},
-			},
-			{
-				name: "checkout branch requires current branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"ch"},
+					Args: []string{"q", "did", "things"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"feature"}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"abc123"}},
+					},
 					WantRunContents: []*commandtest.RunContents{
-						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						repoIDRunContents(),
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
-					},
-					RunResponses: []*commandtest.FakeRun{
-						{Stdout: []string{"/git/root"}},
-						{Err: fmt.Errorf("whoops")},
+						repoRunContents(),
+						{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						gitRootDir.ArgName: "/git/root",
+						messageArg.Name():        []string{"did", "things"},
+						currentBranchArg.ArgName: "feature",
+						repoUrl.Name():           "test-repo",
 					}},
-					WantStderr: "failed to execute shell command: whoops\n",
-					WantErr:    fmt.Errorf(`failed to execute shell command: whoops`),
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git reset --soft abc123 && git commit -m 'did things' && echo Success!`,
+						},
+					},
 				},
 			},
 			{
-				name: "checkout branch requires arg",
+				name: "squash onto default branch",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "trunk",
+					},
+				},
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git reset --soft abc123"),
+							wCmd(`git commit --no-verify -m 'did things'`),
+							wCmd("echo Success!"),
+						},
+					},
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"ch"},
+					Args: []string{"q", "did", "things", "-n"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"feature"}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"abc123"}},
+					},
 					WantRunContents: []*commandtest.RunContents{
-						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						repoIDRunContents(),
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
-					},
-					RunResponses: []*commandtest.FakeRun{
-						{Stdout: []string{"/git/root"}},
-						{Stdout: []string{"some-branch"}},
+						repoRunContents(),
+						{Name: "git", Args: []string{"merge-base", "trunk", "HEAD"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						gitRootDir.ArgName:       "/git/root",
-						currentBranchArg.ArgName: "some-branch",
-						userArg.Name:             "person",
+						messageArg.Name():        []string{"did", "things"},
+						nvFlag.Name():            "--no-verify",
+						currentBranchArg.ArgName: "feature",
+						repoUrl.Name():           "test-repo",
 					}},
-					WantStderr: "Argument \"BRANCH\" requires at least 1 argument, got 0\n",
-					WantErr:    fmt.Errorf(`Argument "BRANCH" requires at least 1 argument, got 0`),
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git reset --soft abc123 && git commit --no-verify -m 'did things' && echo Success!`,
+						},
+					},
 				},
 			},
 			{
-				name: "checkout branch requires one arg",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"ch", "tree", "limb"},
-					WantRunContents: []*commandtest.RunContents{
-						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
-						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
-						{Name: "git", Args: []string{"branch", "--list"}},
+				name: "squash and push",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"feature": "parent",
+						},
+					},
+				},
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							createSSHAgentCommand,
+							wCmd("git reset --soft abc123"),
+							wCmd(`git commit -m 'did things'`),
+							wCmd("git push --force-with-lease"),
+							wCmd("echo Success!"),
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"q", "did", "things", "-p"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"feature"}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"abc123"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+						{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						messageArg.Name():        []string{"did", "things"},
+						pushFlag.Name():          true,
+						currentBranchArg.ArgName: "feature",
+						repoUrl.Name():           "test-repo",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						FunctionWrap: true,
+						Executable: []string{
+							createSSHAgentCommand,
+							`git reset --soft abc123 && git commit -m 'did things' && git push --force-with-lease && echo Success!`,
+						},
+					},
+				},
+			},
+			{
+				name: "squash fails if merge-base fails",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"feature": "parent",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"q", "did", "things"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"feature"}},
+						{Stdout: []string{"test-repo"}},
+						{Err: fmt.Errorf("no merge base")},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+						{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						messageArg.Name():        []string{"did", "things"},
+						currentBranchArg.ArgName: "feature",
+						repoUrl.Name():           "test-repo",
+					}},
+					WantStderr: "failed to get merge base of feature and parent: failed to execute shell command: no merge base\n",
+					WantErr:    fmt.Errorf("failed to get merge base of feature and parent: failed to execute shell command: no merge base"),
+				},
+			},
+			// Checkout new branch
+			{
+				name: "checkout branch requires git root",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ch"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Err: fmt.Errorf("oh no")},
+					},
+					WantStderr: "failed to execute shell command: oh no\n",
+					WantErr:    fmt.Errorf(`failed to execute shell command: oh no`),
+				},
+			},
+			{
+				name: "checkout branch requires current branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ch"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Err: fmt.Errorf("whoops")},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName: "/git/root",
+					}},
+					WantStderr: "failed to execute shell command: whoops\n",
+					WantErr:    fmt.Errorf(`failed to execute shell command: whoops`),
+				},
+			},
+			{
+				name: "checkout branch requires arg",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ch"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Stdout: []string{"some-branch"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/git/root",
+						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+					}},
+					WantStderr: "Argument \"BRANCH\" requires at least 1 argument, got 0\n",
+					WantErr:    fmt.Errorf(`Argument "BRANCH" requires at least 1 argument, got 0`),
+				},
+			},
+			{
+				name: "checkout branch requires one arg",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ch", "tree", "limb"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
 						{Stdout: []string{"/git/root"}},
@@ -1118,7 +1925,7 @@ func TestExecution(t *testing.T) {
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "tree",
+						"BRANCH":                 "tree",
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
 					}},
@@ -1170,7 +1977,88 @@ func TestExecution(t *testing.T) {
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "tree",
+						"BRANCH":                 "tree",
+						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git checkout tree`,
+						},
+					},
+				},
+				want: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "some-branch", Time: fakeNow}},
+					},
+				},
+			},
+			{
+				name: "checks out a branch from the history",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {
+							{Branch: "tree"},
+							{Branch: "some-branch"},
+							{Branch: "other"},
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ch", "tree"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"xyz"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/git/root",
+						"BRANCH":                 "tree",
+						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git checkout tree`,
+						},
+					},
+				},
+				want: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {
+							{Branch: "some-branch", Time: fakeNow},
+							{Branch: "other"},
+						},
+					},
+				},
+			},
+			{
+				name: "checks out a branch and drops the oldest history entry",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": branchVisits(20),
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ch", "tree"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"/git/root"}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"xyz"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						gitRootDir.ArgName:       "/git/root",
+						"BRANCH":                 "tree",
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
 					}},
@@ -1181,8 +2069,8 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "some-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": append([]*BranchVisit{{Branch: "some-branch", Time: fakeNow}}, branchVisits(19)...),
 					},
 				},
 			},
@@ -1195,15 +2083,17 @@ func TestExecution(t *testing.T) {
 						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 						{Name: "git", Args: []string{"branch", "--list"}},
+						repoIDRunContents(),
 					},
 					RunResponses: []*commandtest.FakeRun{
 						{Stdout: []string{"/git/root"}},
 						{Stdout: []string{"some-branch"}},
 						{Stdout: []string{"xyz"}},
+						{Stdout: []string{fakeRepoID}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "tree",
+						"BRANCH":                 "tree",
 						newBranchFlag.Name():     true,
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
@@ -1215,18 +2105,24 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "some-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "some-branch", Time: fakeNow}},
 					},
-					ParentBranches: map[string]string{
-						"tree": "some-branch",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree": "some-branch",
+						},
 					},
 				},
 			},
 			{
 				name: "checks out a new branch - adds to map",
 				g: &git{
-					ParentBranches: map[string]string{},
+					RepoParentBranches: map[string]map[string]string{
+						"/other/repo/.git": {
+							"tree": "other-parent",
+						},
+					},
 				},
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"ch", "tree", "-n"},
@@ -1234,15 +2130,17 @@ func TestExecution(t *testing.T) {
 						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 						{Name: "git", Args: []string{"branch", "--list"}},
+						repoIDRunContents(),
 					},
 					RunResponses: []*commandtest.FakeRun{
 						{Stdout: []string{"/git/root"}},
 						{Stdout: []string{"some-branch"}},
 						{Stdout: []string{"xyz"}},
+						{Stdout: []string{fakeRepoID}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "tree",
+						"BRANCH":                 "tree",
 						newBranchFlag.Name():     true,
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
@@ -1254,20 +2152,27 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "some-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "some-branch", Time: fakeNow}},
 					},
-					ParentBranches: map[string]string{
-						"tree": "some-branch",
+					RepoParentBranches: map[string]map[string]string{
+						"/other/repo/.git": {
+							"tree": "other-parent",
+						},
+						fakeRepoID: {
+							"tree": "some-branch",
+						},
 					},
 				},
 			},
 			{
 				name: "checks out a new branch - overrides value in map",
 				g: &git{
-					ParentBranches: map[string]string{
-						"tree":  "old-branch",
-						"other": "other-branch",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree":  "old-branch",
+							"other": "other-branch",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
@@ -1276,15 +2181,17 @@ func TestExecution(t *testing.T) {
 						{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
 						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 						{Name: "git", Args: []string{"branch", "--list"}},
+						repoIDRunContents(),
 					},
 					RunResponses: []*commandtest.FakeRun{
 						{Stdout: []string{"/git/root"}},
 						{Stdout: []string{"some-branch"}},
 						{Stdout: []string{"xyz"}},
+						{Stdout: []string{fakeRepoID}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "tree",
+						"BRANCH":                 "tree",
 						newBranchFlag.Name():     true,
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
@@ -1296,12 +2203,14 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "some-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "some-branch", Time: fakeNow}},
 					},
-					ParentBranches: map[string]string{
-						"tree":  "some-branch",
-						"other": "other-branch",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree":  "some-branch",
+							"other": "other-branch",
+						},
 					},
 				},
 			},
@@ -1326,7 +2235,7 @@ func TestExecution(t *testing.T) {
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "person/tree",
+						"BRANCH":                 "person/tree",
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
 					}},
@@ -1337,8 +2246,8 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "some-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "some-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -1361,7 +2270,7 @@ func TestExecution(t *testing.T) {
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						gitRootDir.ArgName:       "/git/root",
-						branchArg.Name():         "tree",
+						"BRANCH":                 "tree",
 						currentBranchArg.ArgName: "some-branch",
 						userArg.Name:             "person",
 					}},
@@ -1372,8 +2281,8 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					PreviousBranches: map[string]string{
-						"/git/root": "some-branch",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "some-branch", Time: fakeNow}},
 					},
 				},
 			},
@@ -1381,17 +2290,21 @@ func TestExecution(t *testing.T) {
 			{
 				name: "delete branch requires arg",
 				etc: &commandtest.ExecuteTestCase{
-					Args:       []string{"bd"},
-					WantStderr: "Argument \"BRANCH\" requires at least 1 argument, got 0\n",
-					WantErr:    fmt.Errorf(`Argument "BRANCH" requires at least 1 argument, got 0`),
+					Args:            []string{"bd"},
+					WantRunContents: []*commandtest.RunContents{repoIDRunContents()},
+					RunResponses:    []*commandtest.FakeRun{{Stdout: []string{fakeRepoID}}},
+					WantStderr:      "Argument \"BRANCH\" requires at least 1 argument, got 0\n",
+					WantErr:         fmt.Errorf(`Argument "BRANCH" requires at least 1 argument, got 0`),
 				},
 			},
 			{
 				name: "deletes a branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"bd", "tree"},
+					Args:            []string{"bd", "tree"},
+					WantRunContents: []*commandtest.RunContents{repoIDRunContents()},
+					RunResponses:    []*commandtest.FakeRun{{Stdout: []string{fakeRepoID}}},
 					WantData: &command.Data{Values: map[string]interface{}{
-						branchesArg.Name(): []string{"tree"},
+						"BRANCH": []string{"tree"},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
@@ -1403,15 +2316,19 @@ func TestExecution(t *testing.T) {
 			{
 				name: "deletes a branch in ParentBranches",
 				g: &git{
-					ParentBranches: map[string]string{
-						"abc":  "def",
-						"tree": "root",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"abc":  "def",
+							"tree": "root",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"bd", "tree"},
+					Args:            []string{"bd", "tree"},
+					WantRunContents: []*commandtest.RunContents{repoIDRunContents()},
+					RunResponses:    []*commandtest.FakeRun{{Stdout: []string{fakeRepoID}}},
 					WantData: &command.Data{Values: map[string]interface{}{
-						branchesArg.Name(): []string{"tree"},
+						"BRANCH": []string{"tree"},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
@@ -1420,17 +2337,21 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					ParentBranches: map[string]string{
-						"abc": "def",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"abc": "def",
+						},
 					},
 				},
 			},
 			{
 				name: "deletes multiple branches",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"bd", "tree", "limb"},
+					Args:            []string{"bd", "tree", "limb"},
+					WantRunContents: []*commandtest.RunContents{repoIDRunContents()},
+					RunResponses:    []*commandtest.FakeRun{{Stdout: []string{fakeRepoID}}},
 					WantData: &command.Data{Values: map[string]interface{}{
-						branchesArg.Name(): []string{"tree", "limb"},
+						"BRANCH": []string{"tree", "limb"},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
@@ -1442,17 +2363,21 @@ func TestExecution(t *testing.T) {
 			{
 				name: "deletes multiple branches from ParentBranches",
 				g: &git{
-					ParentBranches: map[string]string{
-						"abc":   "def",
-						"tree":  "root",
-						"other": "branch",
-						"limb":  "leaf",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"abc":   "def",
+							"tree":  "root",
+							"other": "branch",
+							"limb":  "leaf",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"bd", "tree", "limb"},
+					Args:            []string{"bd", "tree", "limb"},
+					WantRunContents: []*commandtest.RunContents{repoIDRunContents()},
+					RunResponses:    []*commandtest.FakeRun{{Stdout: []string{fakeRepoID}}},
 					WantData: &command.Data{Values: map[string]interface{}{
-						branchesArg.Name(): []string{"tree", "limb"},
+						"BRANCH": []string{"tree", "limb"},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
@@ -1461,23 +2386,99 @@ func TestExecution(t *testing.T) {
 					},
 				},
 				want: &git{
-					ParentBranches: map[string]string{
-						"abc":   "def",
-						"other": "branch",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"abc":   "def",
+							"other": "branch",
+						},
+					},
+				},
+			},
+			{
+				name: "deletes a branch and moves its children onto its parent",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree":  "root",
+							"limb":  "tree",
+							"other": "branch",
+						},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":    {{Branch: "tree"}, {Branch: "other"}},
+						"/git/root-wt": {{Branch: "tree"}},
+						"/other/root":  {{Branch: "tree"}},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"bd", "tree"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"worktree /git/root", "branch refs/heads/main", "", "worktree /git/root-wt", "branch refs/heads/other", ""}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"BRANCH": []string{"tree"},
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git branch -d "tree"`,
+						},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"limb":  "root",
+							"other": "branch",
+						},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":   {{Branch: "other"}},
+						"/other/root": {{Branch: "tree"}},
+					},
+				},
+			},
+			{
+				name: "delete branch fails if worktrees can't be listed",
+				g: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root": {{Branch: "tree"}},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"bd", "tree"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Err: fmt.Errorf("oops")},
 					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"BRANCH": []string{"tree"},
+					}},
+					WantStderr: "failed to list worktrees: failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to list worktrees: failed to execute shell command: oops"),
 				},
 			},
 			{
 				name: "force deletes a branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"bd", "-f", "tree"},
+					Args:            []string{"bd", "-f", "tree"},
+					WantRunContents: []*commandtest.RunContents{repoIDRunContents()},
+					RunResponses:    []*commandtest.FakeRun{{Stdout: []string{fakeRepoID}}},
 					WantData: &command.Data{Values: map[string]interface{}{
-						branchArg.Name():   []string{"tree"},
+						"BRANCH":           []string{"tree"},
 						forceDelete.Name(): true,
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git branch -D "tree"`,
+							`git branch -D tree`,
 						},
 					},
 				},
@@ -1500,7 +2501,7 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"ua", "file.one", "some/where/file.2"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						uaArgs.Name(): []string{
+						"FILE": []string{
 							"file.one",
 							"some/where/file.2",
 						},
@@ -1526,7 +2527,7 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"uc", "file.one", "some/where/file.2"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						ucArgs.Name(): []string{
+						"FILE": []string{
 							"file.one",
 							"some/where/file.2",
 						},
@@ -1538,6 +2539,32 @@ func TestExecution(t *testing.T) {
 					},
 				},
 			},
+			{
+				name: "undo change quotes files",
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							`git checkout -- -p 'with space.go' 'it''s.go' '$(touch x).go'`,
+						},
+					},
+					"linux": {
+						wantExecutable: []string{
+							`git checkout -- -p 'with space.go' 'it'\''s.go' '$(touch x).go'`,
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"uc", "-p", "with space.go", "it's.go", "$(touch x).go"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILE": []string{
+							"-p",
+							"with space.go",
+							"it's.go",
+							"$(touch x).go",
+						},
+					}},
+				},
+			},
 			// Status
 			{
 				name: "status with no args",
@@ -1545,7 +2572,7 @@ func TestExecution(t *testing.T) {
 					Args: []string{"s"},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git status `,
+							`git status`,
 						},
 					},
 				},
@@ -1555,14 +2582,14 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"s", "file.one", "some/where/file.2"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						statusFilesArg.Name(): []string{
+						"FILES": []string{
 							"file.one",
 							"some/where/file.2",
 						},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git status file.one some/where/file.2`,
+							`git status -- file.one some/where/file.2`,
 						},
 					},
 				},
@@ -1584,14 +2611,14 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"a", "file.one", "some/where/file.2"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						addFilesArg.Name(): []string{
+						"FILES": []string{
 							"file.one",
 							"some/where/file.2",
 						},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git add file.one some/where/file.2`,
+							`git add -- file.one some/where/file.2`,
 						},
 					},
 				},
@@ -1615,7 +2642,7 @@ func TestExecution(t *testing.T) {
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"a", "file.one", "some/where/file.2", "--whitespace"},
 					WantData: &command.Data{Values: map[string]interface{}{
-						addFilesArg.Name(): []string{
+						"FILES": []string{
 							"file.one",
 							"some/where/file.2",
 						},
@@ -1623,7 +2650,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git add file.one some/where/file.2`,
+							`git add -- file.one some/where/file.2`,
 						},
 					},
 				},
@@ -1647,7 +2674,7 @@ func TestExecution(t *testing.T) {
 						},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						rmFilesArg.Name(): []string{
+						"FILES": []string{
 							"some-file.txt",
 						},
 					}},
@@ -1666,7 +2693,7 @@ func TestExecution(t *testing.T) {
 						},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						rmFilesArg.Name(): []string{
+						"FILES": []string{
 							"some-file.txt",
 							"-rf",
 							"other-file.go",
@@ -1689,7 +2716,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git diff  -- `,
+							`git diff --`,
 						},
 					},
 				},
@@ -1705,14 +2732,14 @@ func TestExecution(t *testing.T) {
 					WantData: &command.Data{Values: map[string]interface{}{
 						commander.Getwd.Name: filepath.Join("/", "fake", "root"),
 						repoUrl.Name():       "test-repo",
-						diffArgs.Name(): []string{
+						"FILE": []string{
 							"this.file",
 							"that/file/txt",
 						},
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git diff  -- this.file that/file/txt`,
+							`git diff -- this.file that/file/txt`,
 						},
 					},
 				},
@@ -1721,21 +2748,33 @@ func TestExecution(t *testing.T) {
 				name: "diff against main branch",
 				etc: &commandtest.ExecuteTestCase{
 					Args: []string{"d", "-m"},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"test-repo"},
-					}},
-					WantRunContents: []*commandtest.RunContents{repoRunContents()},
-					WantData: &command.Data{Values: map[string]interface{}{
-						commander.Getwd.Name: filepath.Join("/", "fake", "root"),
-						repoUrl.Name():       "test-repo",
-						mainFlag.Name():      true,
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"origin/develop"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						remoteHeadRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						commander.Getwd.Name: filepath.Join("/", "fake", "root"),
+						repoUrl.Name():       "test-repo",
+						mainFlag.Name():      true,
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git diff  main `,
+							`git diff develop --`,
 						},
 					},
 				},
+				want: &git{
+					MainBranches: map[string]string{
+						"test-repo": "develop",
+					},
+					DetectedMainBranches: map[string]bool{
+						"test-repo": true,
+					},
+				},
 			},
 			{
 				name: "diff against last commit",
@@ -1750,9 +2789,16 @@ func TestExecution(t *testing.T) {
 						repoUrl.Name():        "test-repo",
 						prevCommitFlag.Name(): true,
 					}},
-					WantExecuteData: &command.ExecuteData{
-						Executable: []string{
-							`git diff  "$(git rev-parse @~1)" `,
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git diff @~1 --",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							"git diff '@~1' --",
 						},
 					},
 				},
@@ -1772,7 +2818,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git diff -w -- `,
+							`git diff -w --`,
 						},
 					},
 				},
@@ -1808,7 +2854,7 @@ func TestExecution(t *testing.T) {
 					WantData: &command.Data{Values: map[string]interface{}{
 						commander.Getwd.Name: filepath.Join("/", "fake", "root"),
 						repoUrl.Name():       "test-repo",
-						diffArgs.Name(): []string{
+						"FILE": []string{
 							"this.file",
 							"that/file/txt",
 						},
@@ -1816,7 +2862,7 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git add this.file that/file/txt`,
+							`git add -- this.file that/file/txt`,
 						},
 					},
 				},
@@ -1832,7 +2878,7 @@ func TestExecution(t *testing.T) {
 					WantData: &command.Data{Values: map[string]interface{}{
 						commander.Getwd.Name: filepath.Join("/", "fake", "root"),
 						repoUrl.Name():       "test-repo",
-						diffArgs.Name(): []string{
+						"FILE": []string{
 							"this.file",
 							"that/file/txt",
 						},
@@ -1842,1094 +2888,4196 @@ func TestExecution(t *testing.T) {
 					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git add this.file that/file/txt`,
+							`git add -- this.file that/file/txt`,
 						},
 					},
 				},
 			},
-			// Rebase tests
 			{
-				name: "Rebase abort",
+				name: "diff against parent branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child": "parent",
+						},
+					},
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"rb", "a"},
+					Args: []string{"d", "-P"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"abc123"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						commander.Getwd.Name:  filepath.Join("/", "fake", "root"),
+						repoUrl.Name():        "test-repo",
+						diffParentFlag.Name(): true,
+					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git rebase --abort`,
+							`git diff abc123 --`,
 						},
 					},
-					WantStdout: "git rebase --abort\n",
 				},
 			},
 			{
-				name: "Rebase abort",
+				name: "diff stat against parent branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child": "parent",
+						},
+					},
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"rb", "c"},
+					Args: []string{"d", "this.file", "--parent", "--stat", "-w"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"abc123"}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						commander.Getwd.Name:  filepath.Join("/", "fake", "root"),
+						repoUrl.Name():        "test-repo",
+						"FILE":                []string{"this.file"},
+						diffParentFlag.Name(): true,
+						diffStatFlag.Name():   "--stat",
+						whitespaceFlag.Name(): "-w",
+					}},
 					WantExecuteData: &command.ExecuteData{
 						Executable: []string{
-							`git rebase --continue`,
+							`git diff -w --stat abc123 -- this.file`,
 						},
 					},
-					WantStdout: "git rebase --continue\n",
 				},
 			},
-			// Config tests
 			{
-				name: "Shows empty config",
+				name: "diff name-only against local changes",
 				etc: &commandtest.ExecuteTestCase{
-					Args:       []string{"cfg", "main", "show"},
-					WantStdout: "No global default branch set; using main\n",
+					Args: []string{"d", "-n"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+					},
+					WantRunContents: []*commandtest.RunContents{repoRunContents()},
+					WantData: &command.Data{Values: map[string]interface{}{
+						commander.Getwd.Name:    filepath.Join("/", "fake", "root"),
+						repoUrl.Name():          "test-repo",
+						diffNameOnlyFlag.Name(): "--name-only",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git diff --name-only --`,
+						},
+					},
 				},
 			},
 			{
-				name: "Shows default branch config",
-				g: &git{
-					DefaultBranch: "other-main",
-					MainBranches: map[string]string{
-						"un":   "main-one",
-						"deux": "main-two",
-					},
-				},
+				name: "diff against parent branch fails if no parent branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "show"},
-					WantStdout: strings.Join([]string{
-						"Global default branch: other-main",
-						"deux: main-two",
-						"un: main-one",
-						"",
-					}, "\n"),
+					Args: []string{"d", "-P"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						commander.Getwd.Name:  filepath.Join("/", "fake", "root"),
+						repoUrl.Name():        "test-repo",
+						diffParentFlag.Name(): true,
+					}},
+					WantStderr: "branch child does not have a known parent branch\n",
+					WantErr:    fmt.Errorf("branch child does not have a known parent branch"),
 				},
 			},
 			{
-				name: "Sets default branch",
-				g:    &git{},
-				want: &git{
-					MainBranches: map[string]string{
-						"some-repo": "db",
+				name: "diff against parent branch fails if merge-base fails",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child": "parent",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "set", "db"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"config",
-							"--get",
-							"remote.origin.url",
-						},
-					}},
+					Args: []string{"d", "-P"},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"child"}},
+						{Stdout: []string{fakeRepoID}},
+						{Err: fmt.Errorf("no merge base")},
+					},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						repoUrl.Name():    "some-repo",
-						defRepoArg.Name(): "db",
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-repo"},
+						commander.Getwd.Name:  filepath.Join("/", "fake", "root"),
+						repoUrl.Name():        "test-repo",
+						diffParentFlag.Name(): true,
 					}},
-					WantStdout: "Setting default branch for some-repo to db\n",
+					WantStderr: "failed to get merge base of child and parent: failed to execute shell command: no merge base\n",
+					WantErr:    fmt.Errorf("failed to get merge base of child and parent: failed to execute shell command: no merge base"),
 				},
 			},
+			// Restack tests
 			{
-				name: "Sets global default branch",
-				g:    &git{},
-				want: &git{
-					DefaultBranch: "Maine",
-				},
+				name: "restack does nothing if no stacked branches",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "set", "Maine", "-g"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"config",
-							"--get",
-							"remote.origin.url",
-						},
-					}},
-					WantData: &command.Data{Values: map[string]interface{}{
-						repoUrl.Name():      "some-repo",
-						defRepoArg.Name():   "Maine",
-						globalConfig.Name(): true,
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-repo"},
-					}},
-					WantStdout: "Setting global default branch to Maine\n",
+					Args: []string{"restack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+					},
+					WantStdout: "No branches are stacked on some-branch\n",
 				},
 			},
 			{
-				name: "Unsets default branch",
+				name: "restack fails if cycle in parent branches",
 				g: &git{
-					MainBranches: map[string]string{
-						"some-repo": "db",
-						"other":     "heh",
-					},
-				},
-				want: &git{
-					MainBranches: map[string]string{
-						"other": "heh",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch":  "other-branch",
+							"other-branch": "some-branch",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "unset"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"config",
-							"--get",
-							"remote.origin.url",
-						},
-					}},
-					WantData: &command.Data{Values: map[string]interface{}{
-						repoUrl.Name(): "some-repo",
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-repo"},
-					}},
-					WantStdout: "Deleting default branch for some-repo\n",
+					Args: []string{"restack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+					},
+					WantStderr: "cycle detected in parent branches\n",
+					WantErr:    fmt.Errorf("cycle detected in parent branches"),
 				},
 			},
 			{
-				name: "Does nothing if no default branch map",
-				g:    &git{},
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "unset"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"config",
-							"--get",
-							"remote.origin.url",
+				name: "restack rebases the entire stack in topological order",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a":     "main",
+							"b":     "a",
+							"c":     "a",
+							"d":     "b",
+							"other": "other-main",
 						},
-					}},
-					WantData: &command.Data{Values: map[string]interface{}{
-						repoUrl.Name(): "some-repo",
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-repo"},
-					}},
-					WantStdout: "No default branch set for this repo\n",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"restack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "main", "a"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "a", "b"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "a", "c"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "b", "d"}},
+						{Name: "git", Args: []string{"checkout", "b"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"b"}},
+						{},
+						{},
+						{},
+						{},
+						{},
+					},
+					WantStdout: "Restacked 4 branch(es) on main\n",
 				},
 			},
 			{
-				name: "Does nothing if no default branch for repo",
+				name: "restack merges the entire stack",
 				g: &git{
-					MainBranches: map[string]string{
-						"other": "dflt",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "unset"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"config",
-							"--get",
-							"remote.origin.url",
-						},
-					}},
+					Args: []string{"restack", "-m"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"checkout", "a"}},
+						{Name: "git", Args: []string{"merge", "--no-edit", "main"}},
+						{Name: "git", Args: []string{"checkout", "b"}},
+						{Name: "git", Args: []string{"merge", "--no-edit", "a"}},
+						{Name: "git", Args: []string{"checkout", "main"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"main"}},
+						{},
+						{},
+						{},
+						{},
+						{},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						repoUrl.Name(): "some-repo",
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-repo"},
+						restackMergeFlag.Name(): true,
 					}},
-					WantStdout: "No default branch set for this repo\n",
+					WantStdout: "Restacked 2 branch(es) on main\n",
 				},
 			},
 			{
-				name: "Unsets global default branch",
+				name: "restack dry run outputs the git commands",
 				g: &git{
-					DefaultBranch: "Maine",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
+						},
+					},
 				},
-				want: &git{},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"cfg", "main", "unset", "-g"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"config",
-							"--get",
-							"remote.origin.url",
-						},
-					}},
+					Args: []string{"-y", "restack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"b"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						repoUrl.Name():      "some-repo",
-						globalConfig.Name(): true,
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-repo"},
+						dryRunFlag.Name(): true,
 					}},
-					WantStdout: "Deleting global default branch\n",
+					WantStdout: strings.Join([]string{
+						`["git" "rebase" "--fork-point" "main" "a"]`,
+						`["git" "rebase" "--fork-point" "a" "b"]`,
+						`["git" "checkout" "b"]`,
+						"# Dry Run Summary",
+						"# Number of executor functions: 0",
+						"# Shell executables:",
+						"",
+					}, "\n"),
 				},
 			},
-			// pr-link tests
 			{
-				name: "pr-link requires current branch",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"rev-parse",
-							"--abbrev-ref",
-							"HEAD",
+				name: "restack continue dry run keeps the stopped restack",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
 						},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Err: fmt.Errorf("oops"),
-					}},
-					WantStderr: "failed to execute shell command: oops\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: oops"),
+					},
+					Restacks: map[string]*Restack{
+						fakeRepoID: {Branch: "main", Merge: true},
+					},
 				},
-			},
-			{
-				name: "pr-link requires repo url",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
+					Args: []string{"-y", "restack", "-c"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
-						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
-						},
+						repoIDRunContents(),
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
-						},
-						{
-							Err: fmt.Errorf("oh no"),
-						},
+						{Stdout: []string{fakeRepoID}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
+						dryRunFlag.Name():          true,
+						restackContinueFlag.Name(): true,
 					}},
-					WantStderr: "failed to execute shell command: oh no\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: oh no"),
+					WantStdout: strings.Join([]string{
+						`["git" "commit" "--no-edit"]`,
+						`["git" "checkout" "a"]`,
+						`["git" "merge" "--no-edit" "main"]`,
+						`["git" "checkout" "main"]`,
+						"# Dry Run Summary",
+						"# Number of executor functions: 0",
+						"# Shell executables:",
+						"",
+					}, "\n"),
 				},
 			},
 			{
-				name: "pr-link requires repo with valid format",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
-					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
+				name: "restack stops on conflict",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
 						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
 						},
 					},
+					Restacks: map[string]*Restack{
+						fakeRepoID: {Branch: "b"},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"restack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "main", "a"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "a", "b"}},
+					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"b"}},
+						{},
+						{Err: fmt.Errorf("conflict")},
+					},
+					WantStderr: "failed to restack b onto a; resolve the conflicts and run `g restack --continue`: failed to execute shell command: conflict\n",
+					WantErr:    fmt.Errorf("failed to restack b onto a; resolve the conflicts and run `g restack --continue`: failed to execute shell command: conflict"),
+				},
+			},
+			{
+				name: "restack stops on merge conflict",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
 						},
-						{
-							Stdout: []string{"some-new-format:org/repo.git"},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
 						},
 					},
+					Restacks: map[string]*Restack{
+						fakeRepoID: {Branch: "main", Merge: true},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"restack", "-m"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"checkout", "a"}},
+						{Name: "git", Args: []string{"merge", "--no-edit", "main"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"main"}},
+						{},
+						{Err: fmt.Errorf("conflict")},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
-						repoUrl.ArgName:          "some-new-format:org/repo.git",
+						restackMergeFlag.Name(): true,
 					}},
-					WantStderr: "Unknown git url format: some-new-format:org/repo.git\n",
-					WantErr:    fmt.Errorf("Unknown git url format: some-new-format:org/repo.git"),
+					WantStderr: "failed to restack a onto main; resolve the conflicts and run `g restack --continue`: failed to execute shell command: conflict\n",
+					WantErr:    fmt.Errorf("failed to restack a onto main; resolve the conflicts and run `g restack --continue`: failed to execute shell command: conflict"),
 				},
 			},
 			{
-				name: "pr-link fails if no parent branch or default main branch",
+				name: "restack continue fails if no restack is in progress",
+				g: &git{
+					Restacks: map[string]*Restack{
+						"/other/repo/.git": {Branch: "b"},
+					},
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
+					Args: []string{"restack", "--continue"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
-						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
-						},
+						repoIDRunContents(),
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/repo.git"},
-						},
+						{Stdout: []string{fakeRepoID}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
-						repoUrl.ArgName:          "git@github.com:user/repo.git",
+						restackContinueFlag.Name(): true,
 					}},
-					WantStderr: "Unknown parent branch for branch tree-branch; and no default main branch set\n",
-					WantErr:    fmt.Errorf("Unknown parent branch for branch tree-branch; and no default main branch set"),
+					WantStderr: "no restack is in progress\n",
+					WantErr:    fmt.Errorf("no restack is in progress"),
 				},
 			},
 			{
-				name: "pr-link works if parent branch set",
+				name: "restack continue fails if rebase continue fails",
 				g: &git{
-					ParentBranches: map[string]string{
-						"tree-branch": "trunk",
+					Restacks: map[string]*Restack{
+						fakeRepoID: {Branch: "b"},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
+					Args: []string{"restack", "--continue"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
-						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"-c", "core.editor=true", "rebase", "--continue"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/repo.git"},
-						},
+						{Stdout: []string{fakeRepoID}},
+						{Err: fmt.Errorf("still conflicted")},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
-						repoUrl.ArgName:          "git@github.com:user/repo.git",
+						restackContinueFlag.Name(): true,
 					}},
-					WantStdout: "https://github.com/user/repo/compare/trunk...tree-branch?expand=1\n",
+					WantStderr: "failed to continue restack: failed to execute shell command: still conflicted\n",
+					WantErr:    fmt.Errorf("failed to continue restack: failed to execute shell command: still conflicted"),
 				},
 			},
 			{
-				name: "pr-link works if default main branch set",
+				name: "restack continue resumes the stack and returns to the original branch",
 				g: &git{
-					MainBranches: map[string]string{
-						"git@github.com:user/repo.git": "maine",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
+							"c": "b",
+						},
+					},
+					Restacks: map[string]*Restack{
+						fakeRepoID:         {Branch: "c"},
+						"/other/repo/.git": {Branch: "x"},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
+							"c": "b",
+						},
+					},
+					Restacks: map[string]*Restack{
+						"/other/repo/.git": {Branch: "x"},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
+					Args: []string{"restack", "-c"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
-						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"-c", "core.editor=true", "rebase", "--continue"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "main", "a"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "a", "b"}},
+						{Name: "git", Args: []string{"rebase", "--fork-point", "b", "c"}},
+						{Name: "git", Args: []string{"checkout", "c"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/repo.git"},
-						},
+						{Stdout: []string{fakeRepoID}},
+						{},
+						{},
+						{},
+						{},
+						{},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
-						repoUrl.ArgName:          "git@github.com:user/repo.git",
+						restackContinueFlag.Name(): true,
 					}},
-					WantStdout: "https://github.com/user/repo/compare/maine...tree-branch?expand=1\n",
+					WantStdout: "Restacked 3 branch(es) on main\n",
 				},
 			},
 			{
-				name: "pr-link uses parent branch over default main branch",
+				name: "restack continue commits merge if the restack was started in merge mode",
 				g: &git{
-					ParentBranches: map[string]string{
-						"tree-branch": "trunk",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+						},
 					},
-					MainBranches: map[string]string{
-						"git@github.com:user/repo.git": "maine",
+					Restacks: map[string]*Restack{
+						fakeRepoID: {Branch: "main", Merge: true},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
+					Args: []string{"restack", "-c"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
-						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"commit", "--no-edit"}},
+						{Name: "git", Args: []string{"checkout", "a"}},
+						{Name: "git", Args: []string{"merge", "--no-edit", "main"}},
+						{Name: "git", Args: []string{"checkout", "main"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/repo.git"},
-						},
+						{Stdout: []string{fakeRepoID}},
+						{},
+						{},
+						{},
+						{},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
-						repoUrl.ArgName:          "git@github.com:user/repo.git",
+						restackContinueFlag.Name(): true,
 					}},
-					WantStdout: "https://github.com/user/repo/compare/trunk...tree-branch?expand=1\n",
+					WantStdout: "Restacked 1 branch(es) on main\n",
 				},
 			},
+			// Rename tests
 			{
-				name: "pr-link works for https remote origin",
-				g: &git{
-					ParentBranches: map[string]string{
-						"tree-branch": "trunk",
-					},
-				},
+				name: "rename requires new branch name",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"pr-link"},
+					Args: []string{"mv", "old"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
-						},
-						{
-							Name: "git",
-							Args: []string{
-								"config",
-								"--get",
-								"remote.origin.url",
-							},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
-						},
-						{
-							Stdout: []string{"https://github.com/user/repo.git"},
-						},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"  old"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
-						repoUrl.ArgName:          "https://github.com/user/repo.git",
+						userArg.Name: "person",
+						"OLD_BRANCH": "old",
 					}},
-					WantStdout: "https://github.com/user/repo/compare/trunk...tree-branch?expand=1\n",
+					WantStderr: "Argument \"NEW_BRANCH\" requires at least 1 argument, got 0\n",
+					WantErr:    fmt.Errorf(`Argument "NEW_BRANCH" requires at least 1 argument, got 0`),
 				},
 			},
-			// Current branch test
 			{
-				name: "fails if current branch has error",
+				name: "rename branch with no metadata",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-						Err:    fmt.Errorf("whoops"),
-					}},
+					Args: []string{"mv", "old", "new"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"  old"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name(): "%s\n",
+						userArg.Name:          "person",
+						"OLD_BRANCH":          "old",
+						mvNewBranchArg.Name(): "new",
 					}},
-					WantStderr: "failed to execute shell command: whoops\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: whoops"),
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git branch -m old new",
+						},
+					},
 				},
 			},
 			{
-				name: "ignores failure if ignore flag provided",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-i"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-						Stderr: []string{"oopsie"},
-						Err:    fmt.Errorf("whoops"),
-					}},
-					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():     "%s\n",
-						ignoreNoBranch.Name(): true,
-					}},
+				name: "rename branch migrates metadata",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"person/old": "trunk",
+							"child":      "person/old",
+							"other":      "trunk",
+						},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":   {{Branch: "person/old"}},
+						"/other/root": {{Branch: "other"}},
+					},
 				},
-			},
-			{
-				name: "prints current branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"mv", "old", "person/new"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"* person/old", "  child", "  other", "  trunk"}},
+						{Stdout: []string{"worktree /git/root", "branch refs/heads/person/old", ""}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name(): "%s\n",
+						userArg.Name:          "person",
+						"OLD_BRANCH":          "person/old",
+						mvNewBranchArg.Name(): "person/new",
 					}},
-					WantStdout: "some-branch\n",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git branch -m person/old person/new",
+						},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"person/new": "trunk",
+							"child":      "person/new",
+							"other":      "trunk",
+						},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":   {{Branch: "person/new"}},
+						"/other/root": {{Branch: "other"}},
+					},
 				},
 			},
 			{
-				name: "prints current branch with custom format",
+				name: "rename default branch updates the repo's default branch",
+				g: &git{
+					DefaultBranch: "master",
+					MainBranches: map[string]string{
+						"git@github.com:user/repo.git":  "master",
+						"git@github.com:user/other.git": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"git@github.com:user/repo.git": true,
+					},
+					Restacks: map[string]*Restack{
+						fakeRepoID:         {Branch: "master"},
+						"/other/repo/.git": {Branch: "master"},
+					},
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-f", "hello, %s; goodbye"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"mv", "master", "main"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"* master"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name(): "hello, %s; goodbye",
+						userArg.Name:          "person",
+						"OLD_BRANCH":          "master",
+						mvNewBranchArg.Name(): "main",
 					}},
-					WantStdout: "hello, some-branch; goodbye",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git branch -m master main",
+						},
+					},
+				},
+				want: &git{
+					DefaultBranch: "master",
+					MainBranches: map[string]string{
+						"git@github.com:user/repo.git":  "main",
+						"git@github.com:user/other.git": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"git@github.com:user/repo.git": true,
+					},
+					Restacks: map[string]*Restack{
+						fakeRepoID:         {Branch: "main"},
+						"/other/repo/.git": {Branch: "master"},
+					},
 				},
 			},
 			{
-				name: "current branch with parent format but no parent",
+				name: "rename default branch updates the global default branch if the repo has no origin",
+				g: &git{
+					DefaultBranch: "master",
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-F", "%s --> "},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"mv", "master", "main"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"* master"}},
+						{Err: fmt.Errorf("no origin")},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():       "%s\n",
-						parentFormatFlag.Name(): "%s --> ",
+						userArg.Name:          "person",
+						"OLD_BRANCH":          "master",
+						mvNewBranchArg.Name(): "main",
 					}},
-					WantStdout: "some-branch\n",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git branch -m master main",
+						},
+					},
+				},
+				want: &git{
+					DefaultBranch: "main",
 				},
 			},
 			{
-				name: "current branch with parent format works",
+				name: "rename branch only updates the history of the current repo",
 				g: &git{
-					ParentBranches: map[string]string{
-						"some-branch": "dad",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":      {{Branch: "feature"}, {Branch: "main"}},
+						"/git/root-wt":   {{Branch: "feature"}},
+						"/other/repo":    {{Branch: "feature"}, {Branch: "main"}},
+						"/other/repo-wt": {{Branch: "feature"}},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-F", "%s --> "},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"mv", "feature", "renamed"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"* main", "  feature"}},
+						{Stdout: []string{"worktree /git/root", "branch refs/heads/main", "", "worktree /git/root-wt", "branch refs/heads/feature", ""}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():       "%s\n",
-						parentFormatFlag.Name(): "%s --> ",
+						userArg.Name:          "person",
+						"OLD_BRANCH":          "feature",
+						mvNewBranchArg.Name(): "renamed",
 					}},
-					WantStdout: "dad --> some-branch\n",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git branch -m feature renamed",
+						},
+					},
+				},
+				want: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":      {{Branch: "renamed"}, {Branch: "main"}},
+						"/git/root-wt":   {{Branch: "renamed"}},
+						"/other/repo":    {{Branch: "feature"}, {Branch: "main"}},
+						"/other/repo-wt": {{Branch: "feature"}},
+					},
 				},
 			},
 			{
-				name: "current branch with parent format works with multiple parents",
+				name: "delete branch only updates the history of the current repo",
 				g: &git{
-					ParentBranches: map[string]string{
-						"some-branch": "dad",
-						"dad":         "granddad",
-						"granddad":    "great granddad",
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":   {{Branch: "feature"}, {Branch: "main"}},
+						"/other/repo": {{Branch: "feature"}, {Branch: "main"}},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-F", "%s --> "},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"bd", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"worktree /git/root", "branch refs/heads/main", ""}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():       "%s\n",
-						parentFormatFlag.Name(): "%s --> ",
+						"BRANCH": []string{"feature"},
 					}},
-					WantStdout: "great granddad --> granddad --> dad --> some-branch\n",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git branch -d "feature"`,
+						},
+					},
+				},
+				want: &git{
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":   {{Branch: "main"}},
+						"/other/repo": {{Branch: "feature"}, {Branch: "main"}},
+					},
 				},
 			},
+			// Reparent tests
 			{
-				name: "current branch works with prefix and suffix",
-				g: &git{
-					ParentBranches: map[string]string{
-						"some-branch": "dad",
-						"dad":         "granddad",
-						"granddad":    "great granddad",
+				name: "reparent requires new parent",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"reparent"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
 					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+					}},
+					WantStderr: "Argument \"BRANCH\" requires at least 1 argument, got 0\n",
+					WantErr:    fmt.Errorf(`Argument "BRANCH" requires at least 1 argument, got 0`),
 				},
+			},
+			{
+				name: "reparent sets parent of current branch",
+				g:    &git{},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-F", "%s --> ", "-p", "((", "-s", "]]"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"reparent", "trunk"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"* some-branch", "  trunk"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():       "%s\n",
-						parentFormatFlag.Name(): "%s --> ",
-						prefixFlag.Name():       "((",
-						suffixFlag.Name():       "]]",
+						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+						"BRANCH":                 []string{"trunk"},
 					}},
-					WantStdout: "((great granddad --> granddad --> dad --> some-branch\n]]",
+					WantStdout: "Set parent of some-branch to trunk\n",
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "trunk",
+						},
+					},
 				},
 			},
 			{
-				name: "current branch fails if cycle with base branch",
+				name: "reparent changes parent of provided branch with user prefix",
 				g: &git{
-					ParentBranches: map[string]string{
-						"some-branch":    "other-branch",
-						"other-branch":   "another-branch",
-						"another-branch": "some-branch",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"person/feature": "old-parent",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-F", "%s --> "},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
-					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():       "%s\n",
-						parentFormatFlag.Name(): "%s --> ",
+					Args: []string{"reparent", "feature", "trunk"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"* some-branch", "  person/feature", "  trunk"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+						"BRANCH":                 []string{"person/feature", "trunk"},
 					}},
-					WantStderr: "cycle detected in parent branches\n",
-					WantErr:    fmt.Errorf("cycle detected in parent branches"),
+					WantStdout: "Changed parent of person/feature from old-parent to trunk\n",
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"person/feature": "trunk",
+						},
+					},
 				},
 			},
 			{
-				name: "current branch fails if cycle with parent branches",
+				name: "reparent rebases onto new parent",
 				g: &git{
-					ParentBranches: map[string]string{
-						"some-branch":    "other-branch",
-						"other-branch":   "another-branch",
-						"another-branch": "other-branch",
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "old-parent",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"current", "-F", "%s --> "},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stdout: []string{"some-branch"},
-					}},
+					Args: []string{"reparent", "trunk", "-r"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"* some-branch", "  trunk"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						formatFlag.Name():       "%s\n",
-						parentFormatFlag.Name(): "%s --> ",
+						currentBranchArg.ArgName:  "some-branch",
+						userArg.Name:              "person",
+						"BRANCH":                  []string{"trunk"},
+						reparentRebaseFlag.Name(): true,
 					}},
-					WantStderr: "cycle detected in parent branches\n",
-					WantErr:    fmt.Errorf("cycle detected in parent branches"),
+					WantStdout: "Changed parent of some-branch from old-parent to trunk\n",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git rebase --onto trunk old-parent some-branch",
+						},
+					},
 				},
-			},
-			// upstream + pr-link tests
-			{
-				name: "upstream + pr-link fails if current branch error",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"up"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Stderr: []string{"argh"},
-						Err:    fmt.Errorf("oops"),
-						Stdout: []string{"some-branch"},
-					}},
-					WantStderr: "argh\nfailed to execute shell command: oops\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: oops"),
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "trunk",
+						},
+					},
 				},
 			},
 			{
-				name: "upstream + pr-link fails if repoUrl error",
+				name: "reparent refuses to create a cycle",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child":      "some-branch",
+							"grandchild": "child",
+						},
+					},
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"up"},
+					Args: []string{"reparent", "grandchild"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-						},
-						{
-							Name: "git",
-							Args: []string{"config", "--get", "remote.origin.url"},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"some-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/some-repo.git"},
-							Stderr: []string{"oh no"},
-							Err:    fmt.Errorf("fudge"),
-						},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"* some-branch", "  child", "  grandchild"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						currentBranchArg.ArgName: "some-branch",
+						userArg.Name:             "person",
+						"BRANCH":                 []string{"grandchild"},
 					}},
-					WantStderr: "oh no\nfailed to execute shell command: fudge\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: fudge"),
+					WantStderr: "setting the parent of some-branch to grandchild would create a cycle\n",
+					WantErr:    fmt.Errorf("setting the parent of some-branch to grandchild would create a cycle"),
 				},
 			},
 			{
-				name: "upstream + pr-link fails if push error",
+				name: "reparent refuses to make branch its own parent",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"up"},
+					Args: []string{"reparent", "some-branch"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-						},
-						{
-							Name: "git",
-							Args: []string{"config", "--get", "remote.origin.url"},
-						},
-						{
-							Name: "git",
-							Args: []string{"push", "--set-upstream", "origin", "some-branch"},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"some-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/some-repo.git"},
-						},
-						{
-							Stdout: []string{"push output"},
-							Stderr: []string{"ugh"},
-							Err:    fmt.Errorf("whoops"),
-						},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"* some-branch"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						currentBranchArg.ArgName: "some-branch",
-						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
+						userArg.Name:             "person",
+						"BRANCH":                 []string{"some-branch"},
 					}},
-					WantStderr: "failed to run git push: failed to execute shell command: whoops\n",
-					WantErr:    fmt.Errorf("failed to run git push: failed to execute shell command: whoops"),
+					WantStderr: "branch some-branch cannot be its own parent\n",
+					WantErr:    fmt.Errorf("branch some-branch cannot be its own parent"),
 				},
 			},
+			// Tree tests
 			{
-				name: "upstream + pr-link fails if printPRLink fails",
+				name: "tree with no parent branches",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"up"},
+					Args: []string{"tree"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-						},
-						{
-							Name: "git",
-							Args: []string{"config", "--get", "remote.origin.url"},
-						},
-						{
-							Name: "git",
-							Args: []string{"push", "--set-upstream", "origin", "some-branch"},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"some-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/some-repo.git"},
-						},
-						{
-							Stdout: []string{"push output"},
-						},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						currentBranchArg.ArgName: "some-branch",
-						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
 					}},
-					WantStderr: "Unknown parent branch for branch some-branch; and no default main branch set\n",
-					WantErr:    fmt.Errorf("Unknown parent branch for branch some-branch; and no default main branch set"),
+					WantStdout: "No parent branches recorded\n",
 				},
 			},
 			{
-				name: "upstream + pr-link works",
+				name: "tree ignores parent branches of other repos",
 				g: &git{
-					ParentBranches: map[string]string{
-						"some-branch": "parent-branch",
+					RepoParentBranches: map[string]map[string]string{
+						"/other/repo/.git": {
+							"a": "main",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"up"},
+					Args: []string{"tree"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
-						},
-						{
-							Name: "git",
-							Args: []string{"config", "--get", "remote.origin.url"},
-						},
-						{
-							Name: "git",
-							Args: []string{"push", "--set-upstream", "origin", "some-branch"},
-						},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
 					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"some-branch"},
-						},
-						{
-							Stdout: []string{"git@github.com:user/some-repo.git"},
-						},
-						{
-							Stdout: []string{"push output"},
-						},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
 					},
 					WantData: &command.Data{Values: map[string]interface{}{
 						currentBranchArg.ArgName: "some-branch",
-						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
 					}},
-					WantStdout: "https://github.com/user/some-repo/compare/parent-branch...some-branch?expand=1\n",
+					WantStdout: "No parent branches recorded\n",
 				},
 			},
-			// DryRun tests
 			{
-				name: "dry run - git log",
+				name: "tree moves legacy parent branches into the current repo",
+				g: &git{
+					legacyParentBranches: map[string]string{
+						"a":               "main",
+						"other-repo-only": "main",
+					},
+				},
+				wantLegacy: map[string]string{
+					"other-repo-only": "main",
+				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"lg", "-y"},
+					Args: []string{"tree"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"rev-list", "--left-right", "--count", "main...a"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"a", "main"}},
+						{Stdout: []string{"a"}},
+						{Stdout: []string{"a", "main"}},
+						{Stdout: []string{"0\t1"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						dryRunFlag.Name(): true,
-						gitLogArg.Name():  1,
+						currentBranchArg.ArgName: "a",
 					}},
 					WantStdout: strings.Join([]string{
-						"# Dry Run Summary",
-						"# Number of executor functions: 0",
-						"# Shell executables:",
-						"git log -n 1",
+						"main",
+						"└── a * [ahead 1, behind 0]",
 						"",
 					}, "\n"),
 				},
-			},
-			{
-				name: "dry run - git commit",
-				osChecks: map[string]*osCheck{
-					"windows": {
-						wantStdout: []string{
-							"# Dry Run Summary",
-							"# Number of executor functions: 0",
-							"# Shell executables:",
-							"",
-							`git commit -m "hello there"`,
-							`if (!$?) { throw "Command failed: git commit -m 'hello there'" }`,
-							`git push`,
-							`if (!$?) { throw "Command failed: git push" }`,
-							`echo Success!`,
-							`if (!$?) { throw "Command failed: echo Success!" }`,
-							"",
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
 						},
 					},
-					"linux": {
-						wantStdout: []string{
-							"# Dry Run Summary",
-							"# Number of executor functions: 0",
-							"# Shell executables:",
-							"",
-							`git commit -m "hello there" && git push && echo Success!`,
-							"",
+				},
+			},
+			{
+				name: "tree fails if cycle in parent branches",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "b",
+							"b": "a",
 						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"-y", "c", "hello", "there", "-p"},
+					Args: []string{"tree"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"a"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						dryRunFlag.Name(): true,
-						messageArg.Name(): []string{"hello", "there"},
-						pushFlag.Name():   true,
+						currentBranchArg.ArgName: "a",
 					}},
-					WantExecuteData: &command.ExecuteData{FunctionWrap: true},
+					WantStderr: "cycle detected in parent branches\n",
+					WantErr:    fmt.Errorf("cycle detected in parent branches"),
 				},
 			},
-			// End branch tests
 			{
-				name: "end branch requires current branch",
-				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"end"},
-					WantRunContents: []*commandtest.RunContents{{
-						Name: "git",
-						Args: []string{
-							"rev-parse",
-							"--abbrev-ref",
-							"HEAD",
+				name: "tree displays the parent branch forest",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a":      "main",
+							"b":      "a",
+							"c":      "a",
+							"d":      "main",
+							"orphan": "deleted",
 						},
-					}},
-					RunResponses: []*commandtest.FakeRun{{
-						Err: fmt.Errorf("oops"),
-					}},
-					WantStderr: "failed to execute shell command: oops\n",
-					WantErr:    fmt.Errorf("failed to execute shell command: oops"),
+					},
 				},
-			},
-			{
-				name: "end branch requires parent branch",
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"end"},
+					Args: []string{"tree"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"rev-list", "--left-right", "--count", "main...a"}},
+						{Name: "git", Args: []string{"rev-list", "--left-right", "--count", "a...b"}},
+						{Name: "git", Args: []string{"rev-list", "--left-right", "--count", "main...d"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"b"}},
+						{Stdout: []string{"a", "b", "d", "main", "orphan"}},
+						{Stdout: []string{"0\t2"}},
+						{Stdout: []string{"3\t1"}},
+						{Stdout: []string{"5\t0"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "b",
+					}},
+					WantStdout: strings.Join([]string{
+						"deleted (missing)",
+						"└── orphan (parent missing)",
+						"main",
+						"├── a [ahead 2, behind 0]",
+						"│   ├── b * [ahead 1, behind 3]",
+						"│   └── c (missing)",
+						"└── d [ahead 0, behind 5]",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "tree fails if rev-list fails",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
 						},
 					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"tree"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"rev-list", "--left-right", "--count", "main...a"}},
+					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"a"}},
+						{Stdout: []string{"a", "main"}},
+						{Err: fmt.Errorf("bad revision")},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "a",
+					}},
+					WantStdout: "main\n",
+					WantStderr: "failed to compare a to main: failed to execute shell command: bad revision\n",
+					WantErr:    fmt.Errorf("failed to compare a to main: failed to execute shell command: bad revision"),
+				},
+			},
+			// Cleanup tests
+			{
+				name: "cleanup with no merged branches",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cleanup"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						repoRunContents(),
+						remoteHeadRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads/"}},
+						{Name: "git", Args: []string{"branch", "--merged", "main", "--format=%(refname:short)"}},
+						{Name: "git", Args: []string{"merge-base", "main", "unmerged"}},
+						{Name: "git", Args: []string{"commit-tree", "unmerged^{tree}", "-p", "abc", "-m", "Squash of unmerged"}},
+						{Name: "git", Args: []string{"cherry", "main", "def"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"origin/main"}},
+						{Stdout: []string{"* main", "  unmerged"}},
+						{Stdout: []string{"main m1", "unmerged u1"}},
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"abc"}},
+						{Stdout: []string{"def"}},
+						{Stdout: []string{"+ def"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name(): "test-repo",
+					}},
+					WantStdout: "No branches have been merged into main\n",
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"test-repo": "main",
+					},
+					DetectedMainBranches: map[string]bool{
+						"test-repo": true,
+					},
+				},
+			},
+			{
+				name: "cleanup skips branches that fail the squash check",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "main",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cleanup"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						repoRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads/"}},
+						{Name: "git", Args: []string{"branch", "--merged", "main", "--format=%(refname:short)"}},
+						{Name: "git", Args: []string{"merge-base", "main", "squashed"}},
+						{Name: "git", Args: []string{"commit-tree", "squashed^{tree}", "-p", "abc", "-m", "Squash of squashed"}},
+						{Name: "git", Args: []string{"cherry", "main", "def"}},
+						{Name: "git", Args: []string{"merge-base", "main", "unrelated"}},
+						{Name: "git", Args: []string{"merge-base", "main", "squashed"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"* main", "  squashed", "  unrelated"}},
+						{Stdout: []string{"main m1", "squashed s1", "unrelated u1"}},
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"abc"}},
+						{Stdout: []string{"def"}},
+						{Stdout: []string{"- def"}},
+						{Err: fmt.Errorf("no merge base")},
+						{Stdout: []string{"abc"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name(): "test-repo",
+					}},
+					WantStdout: strings.Join([]string{
+						"Deleting branches merged into main:",
+						"  squashed (squash-merged)",
+						"",
+					}, "\n"),
+					WantStderr: "failed to get merge base for unrelated: failed to execute shell command: no merge base\n",
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git branch -D squashed`,
+						},
+					},
+				},
+			},
+			{
+				name: "cleanup keeps checked out branches and branches without commits of their own",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "main",
+					},
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"feature":     "main",
+							"new-child":   "feature",
+							"orphan":      "deleted-parent",
+							"merged-leaf": "feature",
 						},
 					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cleanup"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						repoRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads/"}},
+						{Name: "git", Args: []string{"branch", "--merged", "main", "--format=%(refname:short)"}},
+						{Name: "git", Args: []string{"merge-base", "main", "feature"}},
+						{Name: "git", Args: []string{"commit-tree", "feature^{tree}", "-p", "abc", "-m", "Squash of feature"}},
+						{Name: "git", Args: []string{"cherry", "main", "def"}},
+						{Name: "git", Args: []string{"merge-base", "main", "new-child"}},
+						{Name: "git", Args: []string{"commit-tree", "new-child^{tree}", "-p", "abc", "-m", "Squash of new-child"}},
+						{Name: "git", Args: []string{"cherry", "main", "ghi"}},
+						{Name: "git", Args: []string{"merge-base", "feature", "merged-leaf"}},
+						{Name: "git", Args: []string{"merge-base", "main", "merged-main"}},
+						{Name: "git", Args: []string{"rev-list", "--first-parent", "--parents", "x1..main"}},
+						{Name: "git", Args: []string{"merge-base", "main", "new-branch"}},
+						{Name: "git", Args: []string{"rev-list", "--first-parent", "--parents", "m1..main"}},
+						{Name: "git", Args: []string{"merge-base", "main", "orphan"}},
+						{Name: "git", Args: []string{"rev-list", "--first-parent", "--parents", "m1..main"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"* main", "  feature", "+ in-worktree", "  merged-leaf", "  merged-main", "  new-branch", "  new-child", "  orphan"}},
+						{Stdout: []string{"feature f1", "in-worktree w1", "main m2", "merged-leaf l1", "merged-main x1", "new-branch m1", "new-child f1", "orphan m1"}},
+						{Stdout: []string{"in-worktree", "main", "merged-leaf", "merged-main", "new-branch", "orphan"}},
+						{Stdout: []string{"abc"}},
+						{Stdout: []string{"def"}},
+						{Stdout: []string{"+ def"}},
+						{Stdout: []string{"abc"}},
+						{Stdout: []string{"ghi"}},
+						{Stdout: []string{"+ ghi"}},
+						// merged-leaf has commits that aren't in its parent.
+						{Stdout: []string{"abc"}},
+						// merged-main was merged into main with a merge commit.
+						{Stdout: []string{"x1"}},
+						{Stdout: []string{"m2 m1 x1"}},
+						// new-branch and orphan were created from main (which has since
+						// advanced).
+						{Stdout: []string{"m1"}},
+						{Stdout: []string{"m2 m1"}},
+						{Stdout: []string{"m1"}},
+						{Stdout: []string{"m2 m1"}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.Name(): "test-repo",
 					}},
-					WantStderr: "branch tree-branch does not have a known parent branch\n",
-					WantErr:    fmt.Errorf("branch tree-branch does not have a known parent branch"),
+					WantStdout: strings.Join([]string{
+						"Deleting branches merged into main:",
+						"  merged-leaf (parent: feature)",
+						"  merged-main",
+						"",
+					}, "\n"),
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git branch -D merged-leaf merged-main`,
+						},
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"test-repo": "main",
+					},
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"feature":   "main",
+							"new-child": "feature",
+							"orphan":    "deleted-parent",
+						},
+					},
 				},
 			},
 			{
-				name: "end branch succeeds",
+				name: "cleanup deletes merged and squash-merged branches",
 				g: &git{
-					ParentBranches: map[string]string{
-						"tree-branch": "trunk",
+					MainBranches: map[string]string{
+						"test-repo": "main",
+					},
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"merged-one": "main",
+							"squashed":   "merged-one",
+							"child":      "squashed",
+							"feature":    "main",
+						},
 					},
 				},
 				etc: &commandtest.ExecuteTestCase{
-					Args: []string{"end"},
+					Args: []string{"cleanup"},
 					WantRunContents: []*commandtest.RunContents{
-						{
-							Name: "git",
-							Args: []string{
-								"rev-parse",
-								"--abbrev-ref",
-								"HEAD",
-							},
+						repoIDRunContents(),
+						repoRunContents(),
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads/"}},
+						{Name: "git", Args: []string{"branch", "--merged", "main", "--format=%(refname:short)"}},
+						{Name: "git", Args: []string{"merge-base", "main", "squashed"}},
+						{Name: "git", Args: []string{"commit-tree", "squashed^{tree}", "-p", "abc", "-m", "Squash of squashed"}},
+						{Name: "git", Args: []string{"cherry", "main", "def"}},
+						{Name: "git", Args: []string{"merge-base", "main", "unmerged"}},
+						{Name: "git", Args: []string{"commit-tree", "unmerged^{tree}", "-p", "abc", "-m", "Squash of unmerged"}},
+						{Name: "git", Args: []string{"cherry", "main", "ghi"}},
+						{Name: "git", Args: []string{"merge-base", "squashed", "child"}},
+						{Name: "git", Args: []string{"merge-base", "main", "merged-one"}},
+						{Name: "git", Args: []string{"rev-list", "--first-parent", "--parents", "o1..main"}},
+						{Name: "git", Args: []string{"merge-base", "merged-one", "squashed"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"  child", "* feature", "  main", "  merged-one", "  squashed", "  unmerged"}},
+						{Stdout: []string{"child c1", "feature f1", "main m1", "merged-one o1", "squashed s1", "unmerged u1"}},
+						{Stdout: []string{"child", "main", "merged-one"}},
+						{Stdout: []string{"abc"}},
+						{Stdout: []string{"def"}},
+						{Stdout: []string{"- def"}},
+						{Stdout: []string{"abc"}},
+						{Stdout: []string{"ghi"}},
+						{Stdout: []string{"+ ghi"}},
+						{Stdout: []string{"s1"}},
+						{Stdout: []string{"o1"}},
+						{Stdout: []string{"m1 m0 o1"}},
+						{Stdout: []string{"o1"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name(): "test-repo",
+					}},
+					WantStdout: strings.Join([]string{
+						"Deleting branches merged into main:",
+						"  child (parent: squashed)",
+						"  merged-one (parent: main)",
+						"  squashed (squash-merged, parent: merged-one)",
+						"",
+					}, "\n"),
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git branch -D child merged-one squashed`,
+						},
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"test-repo": "main",
+					},
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"feature": "main",
+						},
+					},
+				},
+			},
+			// Rebase tests
+			{
+				name: "Rebase abort",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rb", "a"},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git rebase --abort`,
 						},
 					},
+					WantStdout: "git rebase --abort\n",
+				},
+			},
+			{
+				name: "Rebase continue",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rb", "c"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
 					RunResponses: []*commandtest.FakeRun{
-						{
-							Stdout: []string{"tree-branch"},
+						{Stdout: []string{"1 M. N... 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 resolved.go\x00"}},
+					},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git rebase --continue`,
+						},
+					},
+					WantStdout: "git rebase --continue\n",
+				},
+			},
+			{
+				name: "Rebase continue fails if conflicts remain",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rb", "c"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b a.go",
+							"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b b c.go",
+							"? other.go",
+							"",
+						}, "\x00")}},
+					},
+					WantStderr: "cannot continue while conflicts remain (resolve them with `g ours` or `g theirs`): a.go, b c.go\n",
+					WantErr:    fmt.Errorf("cannot continue while conflicts remain (resolve them with `g ours` or `g theirs`): a.go, b c.go"),
+				},
+			},
+			{
+				name: "Rebase continue fails if status fails",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rb", "c"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Err: fmt.Errorf("oops")},
+					},
+					WantStderr: "failed to get git status: failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to get git status: failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "Rebase skip",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"rb", "s"},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							`git rebase --skip`,
 						},
 					},
+					WantStdout: "git rebase --skip\n",
+				},
+			},
+			// Conflict tests
+			{
+				name: "conflicts with no conflicts",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"conflicts"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"? other.go\x00"}},
+					},
+					WantStdout: "No conflicts\n",
+				},
+			},
+			{
+				name: "conflicts lists unmerged files",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"conflicts"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b a.go",
+							"? other.go",
+							"u DU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b b c.go",
+							"u AA N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b d.go",
+							"",
+						}, "\x00")}},
+					},
+					WantStdout: strings.Join([]string{
+						"a.go (both modified)",
+						"b c.go (deleted by us)",
+						"d.go (both added)",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "ours resolves files",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ours", "a.go", "b.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b a.go",
+							"u AA N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b b.go",
+							"",
+						}, "\x00")}},
+					},
 					WantData: &command.Data{Values: map[string]interface{}{
-						currentBranchArg.ArgName: "tree-branch",
+						"FILES": []string{"a.go", "b.go"},
 					}},
 				},
 				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git checkout --ours -- a.go b.go && git add -- a.go b.go",
+						},
+					},
 					"windows": {
 						wantExecutable: []string{
-							wCmd("git checkout trunk"),
-							wCmd("git pull"),
-							wCmd("gbd tree-branch"),
+							wCmd("git checkout --ours -- a.go b.go"),
+							wCmd("git add -- a.go b.go"),
 						},
-						wantStdout: []string{
-							wCmd("git checkout trunk"),
-							wCmd("git pull"),
-							wCmd("gbd tree-branch"),
+					},
+				},
+			},
+			{
+				name: "theirs resolves files",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"theirs", "a.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b a.go",
 							"",
+						}, "\x00")}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILES": []string{"a.go"},
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git checkout --theirs -- a.go && git add -- a.go",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git checkout --theirs -- a.go"),
+							wCmd("git add -- a.go"),
 						},
 					},
-					"linux": {
-						wantExecutable: []string{
-							"git checkout trunk && git pull && gbd tree-branch",
-						},
-						wantStdout: []string{
-							"git checkout trunk && git pull && gbd tree-branch",
-							"",
-						},
+				},
+			},
+			{
+				name: "ours removes files deleted by us",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ours", "deleted-by-us.go", "deleted-by-them.go", "both-deleted.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u DU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b deleted-by-us.go",
+							"u UD N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b deleted-by-them.go",
+							"u DD N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b both-deleted.go",
+							"",
+						}, "\x00")}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILES": []string{"deleted-by-us.go", "deleted-by-them.go", "both-deleted.go"},
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git checkout --ours -- deleted-by-them.go && git add -- deleted-by-them.go && git rm -- deleted-by-us.go both-deleted.go",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git checkout --ours -- deleted-by-them.go"),
+							wCmd("git add -- deleted-by-them.go"),
+							wCmd("git rm -- deleted-by-us.go both-deleted.go"),
+						},
+					},
+				},
+			},
+			{
+				name: "theirs removes files deleted by them",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"theirs", "deleted-by-us.go", "deleted-by-them.go", "both-deleted.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u DU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b deleted-by-us.go",
+							"u UD N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b deleted-by-them.go",
+							"u DD N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b both-deleted.go",
+							"",
+						}, "\x00")}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILES": []string{"deleted-by-us.go", "deleted-by-them.go", "both-deleted.go"},
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git checkout --theirs -- deleted-by-us.go && git add -- deleted-by-us.go && git rm -- deleted-by-them.go both-deleted.go",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git checkout --theirs -- deleted-by-us.go"),
+							wCmd("git add -- deleted-by-us.go"),
+							wCmd("git rm -- deleted-by-them.go both-deleted.go"),
+						},
+					},
+				},
+			},
+			{
+				name: "theirs removes files deleted on both sides",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"theirs", "both-deleted.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{strings.Join([]string{
+							"u DD N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b both-deleted.go",
+							"",
+						}, "\x00")}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILES": []string{"both-deleted.go"},
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git rm -- both-deleted.go",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git rm -- both-deleted.go"),
+						},
+					},
+				},
+			},
+			{
+				name: "ours fails if conflicts can't be listed",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"ours", "a.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Err: fmt.Errorf("oops")},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILES": []string{"a.go"},
+					}},
+					WantStderr: "failed to get git status: failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to get git status: failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "ours requires files",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"ours"},
+					WantStderr: "Argument \"FILES\" requires at least 1 argument, got 0\n",
+					WantErr:    fmt.Errorf(`Argument "FILES" requires at least 1 argument, got 0`),
+				},
+			},
+			// Worktree tests
+			{
+				name: "wt add creates a worktree for an existing branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "add", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"* main", "  person/feature"}},
+						{Stdout: []string{"worktree /repos/repo", "HEAD abc", "branch refs/heads/main", ""}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "main",
+						userArg.Name:             "person",
+						"BRANCH":                 "person/feature",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git worktree add /repos/repo-person-feature person/feature && cd /repos/repo-person-feature",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git worktree add /repos/repo-person-feature person/feature"),
+							wCmd("cd /repos/repo-person-feature"),
+						},
+					},
+				},
+			},
+			{
+				name: "wt add with new branch records the parent branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"main-child": "main",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "add", "-n", "feature", "/tmp/feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"* main"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						newBranchFlag.Name():     true,
+						currentBranchArg.ArgName: "main",
+						userArg.Name:             "person",
+						"BRANCH":                 "feature",
+						wtPathArg.Name():         "/tmp/feature",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"linux": {
+						wantExecutable: []string{
+							"git worktree add -b feature /tmp/feature && cd /tmp/feature",
+						},
+					},
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git worktree add -b feature /tmp/feature"),
+							wCmd("cd /tmp/feature"),
+						},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"main-child": "main",
+							"feature":    "main",
+						},
+					},
+				},
+			},
+			{
+				name: "wt add fails if worktrees can't be listed",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "add", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"* main", "  feature"}},
+						{Err: fmt.Errorf("oops")},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "main",
+						userArg.Name:             "person",
+						"BRANCH":                 "feature",
+					}},
+					WantStderr: "failed to list worktrees: failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to list worktrees: failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "wt ls lists worktrees",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "ls"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"HEAD abc",
+							"branch refs/heads/main",
+							"",
+							"worktree /repos/repo-feature",
+							"HEAD def",
+							"branch refs/heads/person/feature",
+							"",
+							"worktree /repos/repo-detached",
+							"HEAD ghi",
+							"detached",
+							"",
+						}},
+					},
+					WantStdout: strings.Join([]string{
+						"/repos/repo (main)",
+						"/repos/repo-feature (person/feature)",
+						"/repos/repo-detached (detached)",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "wt cd outputs cd command for the branch's worktree",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "cd", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"branch refs/heads/main",
+							"worktree /repos/repo-feature",
+							"branch refs/heads/person/feature",
+						}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						userArg.Name: "person",
+						"BRANCH":     "feature",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"cd /repos/repo-feature",
+						},
+					},
+				},
+			},
+			{
+				name: "wt cd fails if no worktree has the branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "cd", "other"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"branch refs/heads/main",
+						}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						userArg.Name: "person",
+						"BRANCH":     "other",
+					}},
+					WantStderr: "no worktree has branch other checked out\n",
+					WantErr:    fmt.Errorf("no worktree has branch other checked out"),
+				},
+			},
+			{
+				name: "wt rm removes a clean worktree",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "rm", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+						{Name: "git", Args: []string{"-C", "/repos/repo-feature", "status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"branch refs/heads/main",
+							"worktree /repos/repo-feature",
+							"branch refs/heads/feature",
+						}},
+						{},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						userArg.Name: "person",
+						"BRANCH":     "feature",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git worktree remove /repos/repo-feature",
+						},
+					},
+				},
+			},
+			{
+				name: "wt rm refuses to remove a worktree with uncommitted changes",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "rm", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+						{Name: "git", Args: []string{"-C", "/repos/repo-feature", "status", "--porcelain=v2", "-z"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"branch refs/heads/main",
+							"worktree /repos/repo-feature",
+							"branch refs/heads/feature",
+						}},
+						{Stdout: []string{"? file.go\x00"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						userArg.Name: "person",
+						"BRANCH":     "feature",
+					}},
+					WantStderr: "worktree /repos/repo-feature has uncommitted changes (use --force to remove it anyway)\n",
+					WantErr:    fmt.Errorf("worktree /repos/repo-feature has uncommitted changes (use --force to remove it anyway)"),
+				},
+			},
+			{
+				name: "wt rm force removes a worktree with uncommitted changes",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"wt", "rm", "feature", "-f"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"branch refs/heads/main",
+							"worktree /repos/repo-feature",
+							"branch refs/heads/feature",
+						}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						wtForceFlag.Name(): true,
+						userArg.Name:       "person",
+						"BRANCH":           "feature",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"git worktree remove --force /repos/repo-feature",
+						},
+					},
+				},
+			},
+			// Config tests
+			{
+				name: "Shows empty config",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "main", "show"},
+					WantStdout: "No global default branch set; using main\n",
+				},
+			},
+			{
+				name: "Shows default branch config",
+				g: &git{
+					DefaultBranch: "other-main",
+					MainBranches: map[string]string{
+						"un":   "main-one",
+						"deux": "main-two",
+					},
+					DetectedMainBranches: map[string]bool{
+						"un": true,
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "show"},
+					WantStdout: strings.Join([]string{
+						"Global default branch: other-main",
+						"deux: main-two (set)",
+						"un: main-one (detected)",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "Setting default branch overrides detected branch",
+				g: &git{
+					MainBranches: map[string]string{
+						"some-repo": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"some-repo": true,
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"some-repo": "db",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:            []string{"cfg", "main", "set", "db"},
+					WantRunContents: []*commandtest.RunContents{repoRunContents()},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name():    "some-repo",
+						defRepoArg.Name(): "db",
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "Setting default branch for some-repo to db\n",
+				},
+			},
+			{
+				name: "Sets default branch",
+				g:    &git{},
+				want: &git{
+					MainBranches: map[string]string{
+						"some-repo": "db",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "set", "db"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{
+							"config",
+							"--get",
+							"remote.origin.url",
+						},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name():    "some-repo",
+						defRepoArg.Name(): "db",
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "Setting default branch for some-repo to db\n",
+				},
+			},
+			{
+				name: "Sets global default branch",
+				g:    &git{},
+				want: &git{
+					DefaultBranch: "Maine",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "set", "Maine", "-g"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{
+							"config",
+							"--get",
+							"remote.origin.url",
+						},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name():      "some-repo",
+						defRepoArg.Name():   "Maine",
+						globalConfig.Name(): true,
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "Setting global default branch to Maine\n",
+				},
+			},
+			{
+				name: "Unsets default branch",
+				g: &git{
+					MainBranches: map[string]string{
+						"some-repo": "db",
+						"other":     "heh",
+					},
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"other": "heh",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "unset"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{
+							"config",
+							"--get",
+							"remote.origin.url",
+						},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name(): "some-repo",
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "Deleting default branch for some-repo\n",
+				},
+			},
+			{
+				name: "Shows empty host config",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "host", "show"},
+					WantStdout: "No host types set\n",
+				},
+			},
+			{
+				name: "Shows host config",
+				g: &git{
+					Hosts: map[string]string{
+						"gitlab.example.com": "gitlab",
+						"github.example.com": "github",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "host", "show"},
+					WantStdout: strings.Join([]string{
+						"github.example.com: github",
+						"gitlab.example.com: gitlab",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "Sets host type",
+				g:    &git{},
+				want: &git{
+					Hosts: map[string]string{
+						"gitlab.example.com": "gitlab",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "host", "set", "gitlab.example.com", "gitlab"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						hostArg.Name():     "gitlab.example.com",
+						hostTypeArg.Name(): "gitlab",
+					}},
+					WantStdout: "Setting host type for gitlab.example.com to gitlab\n",
+				},
+			},
+			{
+				name: "Fails to set unknown host type",
+				g:    &git{},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "host", "set", "svn.example.com", "svn"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						hostArg.Name():     "svn.example.com",
+						hostTypeArg.Name(): "svn",
+					}},
+					WantStderr: "Unknown host type \"svn\" (must be one of [bitbucket gitea github gitlab])\n",
+					WantErr:    fmt.Errorf(`Unknown host type "svn" (must be one of [bitbucket gitea github gitlab])`),
+				},
+			},
+			{
+				name: "Unsets host type",
+				g: &git{
+					Hosts: map[string]string{
+						"gitlab.example.com": "gitlab",
+						"github.example.com": "github",
+					},
+				},
+				want: &git{
+					Hosts: map[string]string{
+						"github.example.com": "github",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "host", "unset", "gitlab.example.com"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						hostArg.Name(): "gitlab.example.com",
+					}},
+					WantStdout: "Deleting host type for gitlab.example.com\n",
+				},
+			},
+			{
+				name: "cfg direct show when not set",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "direct", "show"},
+					WantStdout: "Git commands are run through the shell\n",
+				},
+			},
+			{
+				name: "cfg direct show when set",
+				g: &git{
+					DirectExecution: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "direct", "show"},
+					WantStdout: "Git commands are run directly\n",
+				},
+			},
+			{
+				name: "cfg direct set",
+				want: &git{
+					DirectExecution: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "direct", "set"},
+					WantStdout: "Running git commands directly\n",
+				},
+			},
+			{
+				name: "cfg direct unset",
+				g: &git{
+					DirectExecution: true,
+				},
+				want: &git{},
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "direct", "unset"},
+					WantStdout: "Running git commands through the shell\n",
+				},
+			},
+			{
+				name: "cfg direct unset when not set",
+				etc: &commandtest.ExecuteTestCase{
+					Args:       []string{"cfg", "direct", "unset"},
+					WantStdout: "Direct execution is not set\n",
+				},
+			},
+			{
+				name: "Does nothing if no default branch map",
+				g:    &git{},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "unset"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{
+							"config",
+							"--get",
+							"remote.origin.url",
+						},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name(): "some-repo",
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "No default branch set for this repo\n",
+				},
+			},
+			{
+				name: "Does nothing if no default branch for repo",
+				g: &git{
+					MainBranches: map[string]string{
+						"other": "dflt",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "unset"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{
+							"config",
+							"--get",
+							"remote.origin.url",
+						},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name(): "some-repo",
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "No default branch set for this repo\n",
+				},
+			},
+			{
+				name: "Unsets global default branch",
+				g: &git{
+					DefaultBranch: "Maine",
+				},
+				want: &git{},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"cfg", "main", "unset", "-g"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{
+							"config",
+							"--get",
+							"remote.origin.url",
+						},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						repoUrl.Name():      "some-repo",
+						globalConfig.Name(): true,
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-repo"},
+					}},
+					WantStdout: "Deleting global default branch\n",
+				},
+			},
+			// pr-link tests
+			{
+				name: "pr-link requires current branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Err: fmt.Errorf("oops"),
+						},
+					},
+					WantStderr: "failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "pr-link requires repo url",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Err: fmt.Errorf("oh no"),
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+					}},
+					WantStderr: "failed to execute shell command: oh no\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: oh no"),
+				},
+			},
+			{
+				name: "pr-link requires repo with known host",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Stdout: []string{"some-new-format:org/repo.git"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "some-new-format:org/repo.git",
+					}},
+					WantStderr: "No host type configured for some-new-format (run `g cfg host set some-new-format TYPE`)\n",
+					WantErr:    fmt.Errorf("No host type configured for some-new-format (run `g cfg host set some-new-format TYPE`)"),
+				},
+			},
+			{
+				name: "pr-link requires repo with valid format",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+						{Stdout: []string{"/local/path/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "/local/path/repo.git",
+					}},
+					WantStderr: "Unknown git url format: /local/path/repo.git\n",
+					WantErr:    fmt.Errorf("Unknown git url format: /local/path/repo.git"),
+				},
+			},
+			{
+				name: "pr-link works for configured gitlab host",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+						},
+					},
+					Hosts: map[string]string{
+						"gitlab.example.com": "gitlab",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+						{Stdout: []string{"ssh://git@gitlab.example.com:2222/group/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "ssh://git@gitlab.example.com:2222/group/repo.git",
+					}},
+					WantStdout: "https://gitlab.example.com/group/repo/-/merge_requests/new?merge_request%5Bsource_branch%5D=tree-branch&merge_request%5Btarget_branch%5D=trunk\n",
+				},
+			},
+			{
+				name: "pr-link fails if no parent branch or default main branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+						remoteHeadRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/repo.git"},
+						},
+						{
+							Err: fmt.Errorf("not a symbolic ref"),
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStderr: "Unknown parent branch for branch tree-branch; and no default main branch set\n",
+					WantErr:    fmt.Errorf("Unknown parent branch for branch tree-branch; and no default main branch set"),
+				},
+			},
+			{
+				name: "pr-link works if parent branch set",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/repo.git"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/trunk...tree-branch?expand=1\n",
+				},
+			},
+			{
+				name: "pr-link works if default main branch set",
+				g: &git{
+					MainBranches: map[string]string{
+						"git@github.com:user/repo.git": "maine",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/repo.git"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/maine...tree-branch?expand=1\n",
+				},
+			},
+			{
+				name: "pr-link uses parent branch over default main branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+						},
+					},
+					MainBranches: map[string]string{
+						"git@github.com:user/repo.git": "maine",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/repo.git"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/trunk...tree-branch?expand=1\n",
+				},
+			},
+			{
+				name: "pr-link works for https remote origin",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+						{
+							Name: "git",
+							Args: []string{
+								"config",
+								"--get",
+								"remote.origin.url",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+						{
+							Stdout: []string{"https://github.com/user/repo.git"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "https://github.com/user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/trunk...tree-branch?expand=1\n",
+				},
+			},
+			// Current branch test
+			{
+				name: "fails if current branch has error",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-branch"},
+						Err:    fmt.Errorf("whoops"),
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name(): "%s\n",
+					}},
+					WantStderr: "failed to execute shell command: whoops\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: whoops"),
+				},
+			},
+			{
+				name: "ignores failure if ignore flag provided",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-i"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-branch"},
+						Stderr: []string{"oopsie"},
+						Err:    fmt.Errorf("whoops"),
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():     "%s\n",
+						ignoreNoBranch.Name(): true,
+					}},
+				},
+			},
+			{
+				name: "prints current branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-branch"},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name(): "%s\n",
+					}},
+					WantStdout: "some-branch\n",
+				},
+			},
+			{
+				name: "prints current branch with custom format",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-f", "hello, %s; goodbye"},
+					WantRunContents: []*commandtest.RunContents{{
+						Name: "git",
+						Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+					}},
+					RunResponses: []*commandtest.FakeRun{{
+						Stdout: []string{"some-branch"},
+					}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name(): "hello, %s; goodbye",
+					}},
+					WantStdout: "hello, some-branch; goodbye",
+				},
+			},
+			{
+				name: "current branch with parent format but no parent",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-F", "%s --> "},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():       "%s\n",
+						parentFormatFlag.Name(): "%s --> ",
+					}},
+					WantStdout: "some-branch\n",
+				},
+			},
+			{
+				name: "current branch with parent format works",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "dad",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-F", "%s --> "},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():       "%s\n",
+						parentFormatFlag.Name(): "%s --> ",
+					}},
+					WantStdout: "dad --> some-branch\n",
+				},
+			},
+			{
+				name: "current branch with parent format works with multiple parents",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "dad",
+							"dad":         "granddad",
+							"granddad":    "great granddad",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-F", "%s --> "},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():       "%s\n",
+						parentFormatFlag.Name(): "%s --> ",
+					}},
+					WantStdout: "great granddad --> granddad --> dad --> some-branch\n",
+				},
+			},
+			{
+				name: "current branch works with prefix and suffix",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "dad",
+							"dad":         "granddad",
+							"granddad":    "great granddad",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-F", "%s --> ", "-p", "((", "-s", "]]"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():       "%s\n",
+						parentFormatFlag.Name(): "%s --> ",
+						prefixFlag.Name():       "((",
+						suffixFlag.Name():       "]]",
+					}},
+					WantStdout: "((great granddad --> granddad --> dad --> some-branch\n]]",
+				},
+			},
+			{
+				name: "current branch fails if cycle with base branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch":    "other-branch",
+							"other-branch":   "another-branch",
+							"another-branch": "some-branch",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-F", "%s --> "},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():       "%s\n",
+						parentFormatFlag.Name(): "%s --> ",
+					}},
+					WantStderr: "cycle detected in parent branches\n",
+					WantErr:    fmt.Errorf("cycle detected in parent branches"),
+				},
+			},
+			{
+				name: "current branch fails if cycle with parent branches",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch":    "other-branch",
+							"other-branch":   "another-branch",
+							"another-branch": "other-branch",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"current", "-F", "%s --> "},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoIDRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{fakeRepoID}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						formatFlag.Name():       "%s\n",
+						parentFormatFlag.Name(): "%s --> ",
+					}},
+					WantStderr: "cycle detected in parent branches\n",
+					WantErr:    fmt.Errorf("cycle detected in parent branches"),
+				},
+			},
+			{
+				name: "pr-link stack outputs a link for every branch in the stack",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a":     "main",
+							"b":     "a",
+							"c":     "b",
+							"other": "main",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link", "--stack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"b"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						prStackFlag.Name():       true,
+						currentBranchArg.ArgName: "b",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: strings.Join([]string{
+						"a: https://github.com/user/repo/compare/main...a?expand=1",
+						"b: https://github.com/user/repo/compare/a...b?expand=1",
+						"c: https://github.com/user/repo/compare/b...c?expand=1",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "pr-link stack outputs markdown table",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link", "-s", "-m"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"a"}},
+						{Stdout: []string{"https://github.com/user/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						prStackFlag.Name():       true,
+						prMarkdownFlag.Name():    true,
+						currentBranchArg.ArgName: "a",
+						repoUrl.ArgName:          "https://github.com/user/repo.git",
+					}},
+					WantStdout: strings.Join([]string{
+						"### Stack",
+						"",
+						"| # | Branch | Base | PR |",
+						"| - | ------ | ---- | -- |",
+						"| 1 | `a` | `main` | [compare](https://github.com/user/repo/compare/main...a?expand=1) |",
+						"| 2 | `b` | `a` | [compare](https://github.com/user/repo/compare/a...b?expand=1) |",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "pr-link stack skips the root branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"a": "main",
+							"b": "a",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link", "-s"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						prStackFlag.Name():       true,
+						currentBranchArg.ArgName: "main",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: strings.Join([]string{
+						"a: https://github.com/user/repo/compare/main...a?expand=1",
+						"b: https://github.com/user/repo/compare/a...b?expand=1",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "pr-link stack outputs nothing if branch is not in a stack",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link", "-s"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"a"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						prStackFlag.Name():       true,
+						currentBranchArg.ArgName: "a",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "No branches are stacked on a\n",
+				},
+			},
+			{
+				name: "pr-link uses global default branch",
+				g: &git{
+					DefaultBranch: "develop",
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/develop...tree-branch?expand=1\n",
+				},
+			},
+			{
+				name: "pr-link uses remote HEAD branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+						remoteHeadRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+						{Stdout: []string{"origin/master"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/master...tree-branch?expand=1\n",
+				},
+				want: &git{
+					MainBranches: map[string]string{
+						"git@github.com:user/repo.git": "master",
+					},
+					DetectedMainBranches: map[string]bool{
+						"git@github.com:user/repo.git": true,
+					},
+				},
+			},
+			{
+				name: "pr-link base flag overrides parent branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"pr-link", "--base", "release"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						repoRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+						{Stdout: []string{"git@github.com:user/repo.git"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"base":                   "release",
+						currentBranchArg.ArgName: "tree-branch",
+						repoUrl.ArgName:          "git@github.com:user/repo.git",
+					}},
+					WantStdout: "https://github.com/user/repo/compare/release...tree-branch?expand=1\n",
+				},
+			},
+			// upstream + pr-link tests
+			{
+				name: "upstream + pr-link fails if current branch error",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"up"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stderr: []string{"argh"},
+							Err:    fmt.Errorf("oops"),
+							Stdout: []string{"some-branch"},
+						},
+					},
+					WantStderr: "argh\nfailed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "upstream + pr-link fails if repoUrl error",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"up"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+						},
+						{
+							Name: "git",
+							Args: []string{"config", "--get", "remote.origin.url"},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"some-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/some-repo.git"},
+							Stderr: []string{"oh no"},
+							Err:    fmt.Errorf("fudge"),
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "some-branch",
+					}},
+					WantStderr: "oh no\nfailed to execute shell command: fudge\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: fudge"),
+				},
+			},
+			{
+				name: "upstream + pr-link fails if push error",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"up"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+						},
+						{
+							Name: "git",
+							Args: []string{"config", "--get", "remote.origin.url"},
+						},
+						{
+							Name: "git",
+							Args: []string{"push", "--set-upstream", "origin", "some-branch"},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"some-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/some-repo.git"},
+						},
+						{
+							Stdout: []string{"push output"},
+							Stderr: []string{"ugh"},
+							Err:    fmt.Errorf("whoops"),
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "some-branch",
+						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
+					}},
+					WantStderr: "failed to run git push: failed to execute shell command: whoops\n",
+					WantErr:    fmt.Errorf("failed to run git push: failed to execute shell command: whoops"),
+				},
+			},
+			{
+				name: "upstream + pr-link fails if printPRLink fails",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"up"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+						},
+						{
+							Name: "git",
+							Args: []string{"config", "--get", "remote.origin.url"},
+						},
+						{
+							Name: "git",
+							Args: []string{"push", "--set-upstream", "origin", "some-branch"},
+						},
+						remoteHeadRunContents(),
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"some-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/some-repo.git"},
+						},
+						{
+							Stdout: []string{"push output"},
+						},
+						{
+							Err: fmt.Errorf("not a symbolic ref"),
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "some-branch",
+						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
+					}},
+					WantStderr: "Unknown parent branch for branch some-branch; and no default main branch set\n",
+					WantErr:    fmt.Errorf("Unknown parent branch for branch some-branch; and no default main branch set"),
+				},
+			},
+			{
+				name: "upstream + pr-link works",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"some-branch": "parent-branch",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"up"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{"rev-parse", "--abbrev-ref", "HEAD"},
+						},
+						{
+							Name: "git",
+							Args: []string{"config", "--get", "remote.origin.url"},
+						},
+						{
+							Name: "git",
+							Args: []string{"push", "--set-upstream", "origin", "some-branch"},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"some-branch"},
+						},
+						{
+							Stdout: []string{"git@github.com:user/some-repo.git"},
+						},
+						{
+							Stdout: []string{"push output"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "some-branch",
+						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
+					}},
+					WantStdout: "https://github.com/user/some-repo/compare/parent-branch...some-branch?expand=1\n",
+				},
+			},
+			{
+				name: "upstream + pr-link with base flag",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"up", "-b", "release"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"config", "--get", "remote.origin.url"}},
+						{Name: "git", Args: []string{"push", "--set-upstream", "origin", "some-branch"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"some-branch"}},
+						{Stdout: []string{"git@github.com:user/some-repo.git"}},
+						{Stdout: []string{"push output"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"base":                   "release",
+						currentBranchArg.ArgName: "some-branch",
+						repoUrl.ArgName:          "git@github.com:user/some-repo.git",
+					}},
+					WantStdout: "https://github.com/user/some-repo/compare/release...some-branch?expand=1\n",
+				},
+			},
+			// DryRun tests
+			{
+				name: "dry run - git log",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"lg", "-y"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						dryRunFlag.Name(): true,
+						gitLogArg.Name():  1,
+					}},
+					WantStdout: strings.Join([]string{
+						"# Dry Run Summary",
+						"# Number of executor functions: 0",
+						"# Shell executables:",
+						"git log -n 1",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "dry run - git commit",
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantStdout: []string{
+							"# Dry Run Summary",
+							"# Number of executor functions: 0",
+							"# Shell executables:",
+							"",
+							`git commit -m 'hello there'`,
+							`if (!$?) { throw 'Command failed: git commit -m ''hello there''' }`,
+							`git push`,
+							`if (!$?) { throw 'Command failed: git push' }`,
+							`echo Success!`,
+							`if (!$?) { throw 'Command failed: echo Success!' }`,
+							"",
+						},
+					},
+					"linux": {
+						wantStdout: []string{
+							"# Dry Run Summary",
+							"# Number of executor functions: 0",
+							"# Shell executables:",
+							"",
+							`git commit -m 'hello there' && git push && echo Success!`,
+							"",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-y", "c", "hello", "there", "-p"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						dryRunFlag.Name(): true,
+						messageArg.Name(): []string{"hello", "there"},
+						pushFlag.Name():   true,
+					}},
+					WantExecuteData: &command.ExecuteData{FunctionWrap: true},
+				},
+			},
+			// End branch tests
+			{
+				name: "end branch requires current branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"end"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Err: fmt.Errorf("oops"),
+						},
+					},
+					WantStderr: "failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "end branch requires parent branch",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"end"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+					}},
+					WantStderr: "branch tree-branch does not have a known parent branch\n",
+					WantErr:    fmt.Errorf("branch tree-branch does not have a known parent branch"),
+				},
+			},
+			{
+				name: "end branch succeeds",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"end"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{
+							Name: "git",
+							Args: []string{
+								"rev-parse",
+								"--abbrev-ref",
+								"HEAD",
+							},
+						},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{
+							Stdout: []string{"tree-branch"},
+						},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git checkout trunk"),
+							wCmd("git pull"),
+							wCmd("git branch -d tree-branch"),
+						},
+						wantStdout: []string{
+							wCmd("git checkout trunk"),
+							wCmd("git pull"),
+							wCmd("git branch -d tree-branch"),
+							"",
+						},
+					},
+					"linux": {
+						wantExecutable: []string{
+							"git checkout trunk && git pull && git branch -d tree-branch",
+						},
+						wantStdout: []string{
+							"git checkout trunk && git pull && git branch -d tree-branch",
+							"",
+						},
+					},
+				},
+				want: &git{},
+			},
+			{
+				name: "end branch moves children and clears previous branch",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+							"child-one":   "tree-branch",
+							"child-two":   "tree-branch",
+							"other":       "trunk",
+						},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/git/root":   {{Branch: "tree-branch"}},
+						"/other/root": {{Branch: "other"}},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"end", "-f"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+						{Stdout: []string{"worktree /git/root", "branch refs/heads/tree-branch", ""}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						forceDelete.Name():       true,
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git checkout trunk"),
+							wCmd("git pull"),
+							wCmd("git branch -D tree-branch"),
+						},
+						wantStdout: []string{
+							wCmd("git checkout trunk"),
+							wCmd("git pull"),
+							wCmd("git branch -D tree-branch"),
+							"",
+						},
+					},
+					"linux": {
+						wantExecutable: []string{
+							"git checkout trunk && git pull && git branch -D tree-branch",
+						},
+						wantStdout: []string{
+							"git checkout trunk && git pull && git branch -D tree-branch",
+							"",
+						},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child-one": "trunk",
+							"child-two": "trunk",
+							"other":     "trunk",
+						},
+					},
+					BranchHistory: map[string][]*BranchVisit{
+						"/other/root": {{Branch: "other"}},
+					},
+				},
+			},
+			{
+				name: "end branch restacks children",
+				g: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"tree-branch": "trunk",
+							"child":       "tree-branch",
+							"grandchild":  "child",
+						},
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"end", "--restack"},
+					WantRunContents: []*commandtest.RunContents{
+						repoIDRunContents(),
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{fakeRepoID}},
+						{Stdout: []string{"tree-branch"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						currentBranchArg.ArgName: "tree-branch",
+						endRestackFlag.Name():    true,
+					}},
+				},
+				osChecks: map[string]*osCheck{
+					"windows": {
+						wantExecutable: []string{
+							wCmd("git checkout trunk"),
+							wCmd("git pull"),
+							wCmd("git rebase --onto trunk tree-branch child"),
+							wCmd("git rebase --fork-point child grandchild"),
+							wCmd("git checkout trunk"),
+							wCmd("git branch -d tree-branch"),
+						},
+						wantStdout: []string{
+							wCmd("git checkout trunk"),
+							wCmd("git pull"),
+							wCmd("git rebase --onto trunk tree-branch child"),
+							wCmd("git rebase --fork-point child grandchild"),
+							wCmd("git checkout trunk"),
+							wCmd("git branch -d tree-branch"),
+							"",
+						},
+					},
+					"linux": {
+						wantExecutable: []string{
+							"git checkout trunk && git pull && git rebase --onto trunk tree-branch child && git rebase --fork-point child grandchild && git checkout trunk && git branch -d tree-branch",
+						},
+						wantStdout: []string{
+							"git checkout trunk && git pull && git rebase --onto trunk tree-branch child && git rebase --fork-point child grandchild && git checkout trunk && git branch -d tree-branch",
+							"",
+						},
+					},
+				},
+				want: &git{
+					RepoParentBranches: map[string]map[string]string{
+						fakeRepoID: {
+							"child":      "trunk",
+							"grandchild": "child",
+						},
+					},
+				},
+			},
+			// Direct execution
+			{
+				name: "direct flag runs git commands directly",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "c", "it's", "$HOME"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"commit", "-m", "it's $HOME"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"[main abc123] it's $HOME"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name(): true,
+						messageArg.Name(): []string{"it's", "$HOME"},
+					}},
+					WantStdout: "[main abc123] it's $HOME\nSuccess!\n",
+				},
+			},
+			{
+				name: "direct execution config runs git commands directly",
+				g: &git{
+					DirectExecution: true,
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"a", "with space.go", "-dash.go"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"add", "--", "with space.go", "-dash.go"}},
+					},
+					RunResponses: []*commandtest.FakeRun{{}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						"FILES": []string{"with space.go", "-dash.go"},
+					}},
+				},
+			},
+			{
+				name: "direct execution runs rm directly",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "rm", "with space.txt", "-rf"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "rm", Args: []string{"with space.txt", "-rf"}},
+					},
+					RunResponses: []*commandtest.FakeRun{{}},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name(): true,
+						"FILES":           []string{"with space.txt", "-rf"},
+					}},
+				},
+			},
+			{
+				name: "direct execution dry run outputs rm args",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-y", "-x", "rm", "a.txt"},
+					WantData: &command.Data{Values: map[string]interface{}{
+						dryRunFlag.Name(): true,
+						directFlag.Name(): true,
+						"FILES":           []string{"a.txt"},
+					}},
+					WantStdout: strings.Join([]string{
+						`["rm" "a.txt"]`,
+						"# Dry Run Summary",
+						"# Number of executor functions: 0",
+						"# Shell executables:",
+						"",
+					}, "\n"),
+				},
+			},
+			{
+				name: "direct execution cds into worktree",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "wt", "cd", "feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"worktree", "list", "--porcelain"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{
+							"worktree /repos/repo",
+							"branch refs/heads/main",
+							"worktree /repos/repo feature",
+							"branch refs/heads/feature",
+						}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name(): true,
+						userArg.Name:      "person",
+						"BRANCH":          "feature",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{
+							"cd '/repos/repo feature'",
+						},
+					},
+				},
+			},
+			{
+				name: "direct execution runs all commands",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "mainest",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "mm", "-f"},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"fetch", "origin", "mainest"}},
+						{Name: "git", Args: []string{"merge", "origin/mainest"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stdout: []string{"fetched"}},
+						{Stdout: []string{"merged"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name():  true,
+						mmFetchFlag.Name(): true,
+						repoUrl.Name():     "test-repo",
+					}},
+					WantStdout: "fetched\nmerged\n",
+				},
+			},
+			{
+				name: "direct execution stops at the first failure",
+				g: &git{
+					MainBranches: map[string]string{
+						"test-repo": "mainest",
+					},
+				},
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "mm", "-f"},
+					WantRunContents: []*commandtest.RunContents{
+						repoRunContents(),
+						{Name: "git", Args: []string{"fetch", "origin", "mainest"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"test-repo"}},
+						{Stderr: []string{"fatal: couldn't find remote ref mainest"}, Err: fmt.Errorf("oops")},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name():  true,
+						mmFetchFlag.Name(): true,
+						repoUrl.Name():     "test-repo",
+					}},
+					WantStderr: "fatal: couldn't find remote ref mainest\nfailed to run git fetch origin mainest: failed to execute shell command: oops\n",
+					WantErr:    fmt.Errorf("failed to run git fetch origin mainest: failed to execute shell command: oops"),
+				},
+			},
+			{
+				name: "direct execution doesn't output success message on failure",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "c", "did", "things"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"commit", "-m", "did things"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Err: fmt.Errorf("nothing to commit")},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name(): true,
+						messageArg.Name(): []string{"did", "things"},
+					}},
+					WantStderr: "failed to run git commit -m 'did things': failed to execute shell command: nothing to commit\n",
+					WantErr:    fmt.Errorf("failed to run git commit -m 'did things': failed to execute shell command: nothing to commit"),
+				},
+			},
+			{
+				name: "direct execution still uses the shell to cd",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-x", "wt", "add", "feature", "/tmp/feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+						{Name: "git", Args: []string{"worktree", "add", "/tmp/feature", "feature"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"* main", "  feature"}},
+						{Stdout: []string{"Preparing worktree"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						directFlag.Name():        true,
+						currentBranchArg.ArgName: "main",
+						userArg.Name:             "person",
+						"BRANCH":                 "feature",
+						wtPathArg.Name():         "/tmp/feature",
+					}},
+					WantExecuteData: &command.ExecuteData{
+						Executable: []string{"cd /tmp/feature"},
+					},
+					WantStdout: "Preparing worktree\n",
+				},
+			},
+			{
+				name: "direct execution dry run outputs args",
+				etc: &commandtest.ExecuteTestCase{
+					Args: []string{"-y", "-x", "wt", "add", "feature", "/tmp/feature"},
+					WantRunContents: []*commandtest.RunContents{
+						{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+						{Name: "git", Args: []string{"branch", "--list"}},
+					},
+					RunResponses: []*commandtest.FakeRun{
+						{Stdout: []string{"main"}},
+						{Stdout: []string{"* main", "  feature"}},
+					},
+					WantData: &command.Data{Values: map[string]interface{}{
+						dryRunFlag.Name():        true,
+						directFlag.Name():        true,
+						currentBranchArg.ArgName: "main",
+						userArg.Name:             "person",
+						"BRANCH":                 "feature",
+						wtPathArg.Name():         "/tmp/feature",
+					}},
+					WantStdout: strings.Join([]string{
+						`["git" "worktree" "add" "/tmp/feature" "feature"]`,
+						"# Dry Run Summary",
+						"# Number of executor functions: 0",
+						"# Shell executables:",
+						"cd /tmp/feature",
+						"",
+					}, "\n"),
+				},
+			},
+			/* Useful for commenting out tests. */
+		} {
+			t.Run(fmt.Sprintf("[%s] %s", curOS.Name(), test.name), func(t *testing.T) {
+				test.etc.Env = map[string]string{
+					"USER": "person",
+				}
+				commandtest.StubGetwd(t, filepath.Join("/", "fake", "root"), nil)
+				commandtest.StubValue(t, &sourcerer.CurrentOS, curOS)
+				commandtest.StubValue(t, &timeNow, func() time.Time { return fakeNow })
+				checkOS := curOS.Name()
+				if shellFor(checkOS) == posixShell {
+					checkOS = "linux"
+				}
+				if oschk, ok := test.osChecks[checkOS]; ok {
+					if test.etc.WantExecuteData == nil {
+						test.etc.WantExecuteData = &command.ExecuteData{}
+					}
+					test.etc.WantExecuteData.Executable = oschk.wantExecutable
+					if test.etc.WantStdout == "" {
+						test.etc.WantStdout = strings.Join(oschk.wantStdout, "\n")
+					}
+				}
+
+				if test.g == nil {
+					test.g = CLI()
+				}
+				test.etc.Node = test.g.Node()
+				commandertest.ExecuteTest(t, test.etc)
+				commandertest.ChangeTest(t, test.want, test.g, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty())
+				if diff := cmp.Diff(test.wantLegacy, test.g.legacyParentBranches, cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("Execute(%v) produced incorrect legacy parent branches (-want, +got):\n%s", test.etc.Args, diff)
+				}
+			})
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	stubStat := func(existing ...string) func(string) (os.FileInfo, error) {
+		return func(s string) (os.FileInfo, error) {
+			if slices.Contains(existing, s) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("file does not exist")
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		g        *git
+		want     *git
+		existing []string
+		etc      *commandtest.ExecuteTestCase
+	}{
+		{
+			name: "prune does nothing if everything exists",
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+					},
+				},
+				BranchHistory: map[string][]*BranchVisit{
+					"/repo": {{Branch: "main"}},
+				},
+			},
+			existing: []string{"/repo"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "prune"},
+				WantRunContents: []*commandtest.RunContents{
+					{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					repoIDRunContents(),
+					{Name: "git", Args: []string{"-C", "/repo", "branch", "--list"}},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"/repo"}},
+					{Stdout: []string{fakeRepoID}},
+					{Stdout: []string{"a", "main"}},
+				},
+				WantStdout: "Nothing to prune\n",
+			},
+		},
+		{
+			name: "prune does not remove parent branches if not in a repo",
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+					},
+				},
+			},
+			existing: []string{fakeRepoID},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "prune"},
+				WantRunContents: []*commandtest.RunContents{
+					{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Err: fmt.Errorf("not a git repository")},
+				},
+				WantStdout: "Nothing to prune\n",
+			},
+		},
+		{
+			name: "prune removes missing branches and directories",
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+						"b": "a",
+						"c": "b",
+						"d": "gone-parent",
+						"e": "gone-parent",
+					},
+				},
+				BranchHistory: map[string][]*BranchVisit{
+					"/gone": {{Branch: "x"}},
+					"/repo": {{Branch: "deleted-prev"}, {Branch: "main"}},
+				},
+			},
+			want: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"c": "main",
+					},
+				},
+				BranchHistory: map[string][]*BranchVisit{
+					"/repo": {{Branch: "main"}},
+				},
+			},
+			existing: []string{"/repo"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "prune"},
+				WantRunContents: []*commandtest.RunContents{
+					{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					repoIDRunContents(),
+					{Name: "git", Args: []string{"-C", "/repo", "branch", "--list"}},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"/repo"}},
+					{Stdout: []string{fakeRepoID}},
+					{Stdout: []string{"c", "e", "main"}},
+				},
+				WantStdout: strings.Join([]string{
+					"Removing branch history for missing directory /gone",
+					"Removing deleted-prev from the branch history for /repo",
+					"Removing parent branch entry for missing branch a",
+					"Removing parent branch entry for missing branch b",
+					"Reattaching c from b to main",
+					"Removing parent branch entry for missing branch d",
+					"Removing parent branch entry for e (parent gone-parent no longer exists)",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "prune removes parent branches for missing repos",
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+					},
+					"/gone/.git": {
+						"x": "y",
+					},
+					"/other/.git": {
+						"z": "main",
+					},
+				},
+			},
+			want: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+					},
+					"/other/.git": {
+						"z": "main",
+					},
+				},
+			},
+			existing: []string{"/repo", "/other/.git"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "prune"},
+				WantRunContents: []*commandtest.RunContents{
+					{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					repoIDRunContents(),
+					{Name: "git", Args: []string{"-C", "/repo", "branch", "--list"}},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"/repo"}},
+					{Stdout: []string{fakeRepoID}},
+					{Stdout: []string{"a", "main"}},
+				},
+				WantStdout: strings.Join([]string{
+					"Removing parent branches for missing repo /gone/.git",
+					"",
+				}, "\n"),
+			},
+		},
+		{
+			name: "prune fails if repo can't be determined",
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+					},
+				},
+			},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "prune"},
+				WantRunContents: []*commandtest.RunContents{
+					{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					repoIDRunContents(),
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"/repo"}},
+					{Err: fmt.Errorf("oops")},
+				},
+				WantStderr: "failed to get git repo: failed to execute shell command: oops\n",
+				WantErr:    fmt.Errorf("failed to get git repo: failed to execute shell command: oops"),
+			},
+		},
+		{
+			name: "prune dry run makes no changes",
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"a": "main",
+						"b": "a",
 					},
 				},
 			},
-			/* Useful for commenting out tests. */
-		} {
-			t.Run(fmt.Sprintf("[%s] %s", curOS.Name(), test.name), func(t *testing.T) {
-				test.etc.Env = map[string]string{
-					"USER": "person",
-				}
-				commandtest.StubGetwd(t, filepath.Join("/", "fake", "root"), nil)
-				commandtest.StubValue(t, &sourcerer.CurrentOS, curOS)
-				if oschk, ok := test.osChecks[curOS.Name()]; ok {
-					if test.etc.WantExecuteData == nil {
-						test.etc.WantExecuteData = &command.ExecuteData{}
-					}
-					test.etc.WantExecuteData.Executable = oschk.wantExecutable
-					if test.etc.WantStdout == "" {
-						test.etc.WantStdout = strings.Join(oschk.wantStdout, "\n")
-					}
-				}
-
-				if test.g == nil {
-					test.g = CLI()
-				}
-				test.etc.Node = test.g.Node()
-				commandertest.ExecuteTest(t, test.etc)
-				commandertest.ChangeTest(t, test.want, test.g, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty())
-			})
-		}
+			existing: []string{"/repo"},
+			etc: &commandtest.ExecuteTestCase{
+				Args: []string{"cfg", "prune", "-y"},
+				WantRunContents: []*commandtest.RunContents{
+					{Name: "git", Args: []string{"rev-parse", "--show-toplevel"}},
+					repoIDRunContents(),
+					{Name: "git", Args: []string{"-C", "/repo", "branch", "--list"}},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"/repo"}},
+					{Stdout: []string{fakeRepoID}},
+					{Stdout: []string{"b", "main"}},
+				},
+				WantData: &command.Data{Values: map[string]interface{}{
+					dryRunFlag.Name(): true,
+				}},
+				WantStdout: strings.Join([]string{
+					"Removing parent branch entry for missing branch a",
+					"Reattaching b from a to main",
+					"Dry run: no changes were made",
+					"# Dry Run Summary",
+					"# Number of executor functions: 0",
+					"# Shell executables:",
+					"",
+				}, "\n"),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commandtest.StubValue(t, &osStat, stubStat(test.existing...))
+			if test.want == nil {
+				test.want = test.g
+			}
+			test.etc.Node = test.g.Node()
+			commandertest.ExecuteTest(t, test.etc)
+			commandertest.ChangeTest(t, test.want, test.g, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty())
+		})
 	}
 }
 
@@ -3007,7 +7155,31 @@ var (
 		true,
 		true,
 	}
-
+	renamedCachedFile = &gitStatusFile{
+		"renamed-cached.go",
+		[]string{
+			// With -z, the original path is a separate record
+			"2 R. N... 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be R100 renamed-cached.go",
+			"renamed-original.go",
+		},
+		false,
+		true,
+	}
+	renamedCachedModifiedFile = &gitStatusFile{
+		"renamed-cached-modified.go",
+		[]string{
+			"2 RM N... 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be R087 renamed-cached-modified.go",
+			"renamed-modified-original.go",
+		},
+		true,
+		true,
+	}
+	unmergedFile = &gitStatusFile{
+		"unmerged.go",
+		[]string{"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b unmerged.go"},
+		true,
+		false,
+	}
 	allFiles = []*gitStatusFile{
 		modifiedFile,
 		modifiedCachedFile,
@@ -3019,6 +7191,9 @@ var (
 		createdCachedFile,
 		createdCachedModifiedFile,
 		createdCachedDeletedFile,
+		renamedCachedFile,
+		renamedCachedModifiedFile,
+		unmergedFile,
 	}
 
 	diffNameFiles       = functional.Filter(allFiles, func(f *gitStatusFile) bool { return f.diffNameOnly })
@@ -3041,6 +7216,8 @@ func TestAutocompletePorcelain(t *testing.T) {
 				createdFile,
 				createdCachedModifiedFile,
 				createdCachedDeletedFile,
+				renamedCachedModifiedFile,
+				unmergedFile,
 			},
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd a ",
@@ -3057,6 +7234,8 @@ func TestAutocompletePorcelain(t *testing.T) {
 				createdFile,
 				createdCachedModifiedFile,
 				createdCachedDeletedFile,
+				renamedCachedModifiedFile,
+				unmergedFile,
 			},
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd rm ",
@@ -3073,6 +7252,8 @@ func TestAutocompletePorcelain(t *testing.T) {
 				createdFile,
 				createdCachedModifiedFile,
 				createdCachedDeletedFile,
+				renamedCachedModifiedFile,
+				unmergedFile,
 			},
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd uc ",
@@ -3089,6 +7270,9 @@ func TestAutocompletePorcelain(t *testing.T) {
 				createdCachedFile,
 				createdCachedModifiedFile,
 				createdCachedDeletedFile,
+				renamedCachedFile,
+				renamedCachedModifiedFile,
+				unmergedFile,
 			},
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd ua ",
@@ -3108,6 +7292,9 @@ func TestAutocompletePorcelain(t *testing.T) {
 				createdCachedFile,
 				createdCachedModifiedFile,
 				createdCachedDeletedFile,
+				renamedCachedFile,
+				renamedCachedModifiedFile,
+				unmergedFile,
 			},
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd s ",
@@ -3123,11 +7310,11 @@ func TestAutocompletePorcelain(t *testing.T) {
 				statuses = append(statuses, f.porcelain...)
 			}
 			test.ctc.RunResponses = []*commandtest.FakeRun{{
-				Stdout: statuses,
+				Stdout: []string{strings.Join(statuses, "\x00") + "\x00"},
 			}}
 			test.ctc.WantRunContents = []*commandtest.RunContents{{
 				Name: "git",
-				Args: []string{"status", "--porcelain=v2"},
+				Args: []string{"status", "--porcelain=v2", "-z"},
 			}}
 
 			test.ctc.Want = &command.Autocompletion{
@@ -3143,6 +7330,7 @@ func TestAutocompletePorcelain(t *testing.T) {
 func TestAutocomplete(t *testing.T) {
 	for _, test := range []struct {
 		name     string
+		g        *git
 		ctc      *commandtest.CompleteTestCase
 		getwd    string
 		getwdErr error
@@ -3158,29 +7346,276 @@ func TestAutocomplete(t *testing.T) {
 			},
 		},
 		{
-			name:  "Completions for diff fails if git root fails",
+			name:  "Completions for diff fails if git root fails",
+			getwd: filepath.Join("/", "fake", "root"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{
+						Err:    fmt.Errorf("oh no"),
+						Stdout: []string{"bloop"},
+						Stderr: []string{"blop"},
+					},
+				},
+				WantErr: fmt.Errorf("failed to get git root: failed to execute shell command: oh no"),
+			},
+		},
+		{
+			name:  "Completions for diff fails if git diff command fails",
+			getwd: filepath.Join("/", "fake", "root"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{
+						Stdout: []string{filepath.Join("/", "fake", "root")},
+					},
+					{
+						Err:    fmt.Errorf("whoops"),
+						Stdout: []string{"abc", "def"},
+						Stderr: []string{"ghi", "jkl", "mno"},
+					},
+				},
+				WantErr: fmt.Errorf("failed to get diffable files: failed to execute shell command: whoops"),
+			},
+		},
+		{
+			name:  "Completions for diff fails if relative filepath fails",
+			getwd: filepath.Join("/", "fake", "root"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "--cached"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{
+						Stdout: []string{"not-absolute-path"},
+					},
+					{
+						Stdout: []string{nameStatus("abc", "def")},
+					},
+					{},
+				},
+				WantErr: fmt.Errorf("failed to get relative path: Rel: can't make %s relative to %s", filepath.Join("not-absolute-path", "abc"), filepath.Join("/", "fake", "root")),
+			},
+		},
+		{
+			name:  "Completions for diff works when in the same root",
+			getwd: filepath.Join("/", "fake", "root"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "--cached"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{
+						Stdout: []string{filepath.Join("/", "fake", "root")},
+					},
+					{
+						Stdout: []string{nameStatus("abc", filepath.Join("def", "ghi"))},
+					},
+					{},
+				},
+				Want: &command.Autocompletion{
+					Suggestions: []string{"abc", filepath.Join("def", "ghi")},
+				},
+			},
+		},
+		{
+			name:  "Completions for diff works when diffs are in the parent directory",
+			getwd: filepath.Join("/", "fake", "root", "some-folder"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "--cached"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{
+						Stdout: []string{filepath.Join("/", "fake", "root")},
+					},
+					{
+						Stdout: []string{nameStatus(
+							"abc",
+							filepath.Join("def", "ghi"),
+							filepath.Join("some-folder", "123"),
+							filepath.Join("some-folder", "sub-folder", "456"),
+						)},
+					},
+					{},
+				},
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						filepath.Join("..", "abc"),
+						filepath.Join("..", "def", "ghi"),
+						filepath.Join("123"),
+						filepath.Join("sub-folder", "456"),
+					},
+				},
+			},
+		},
+		{
+			// This wouldn't ever really happen (as we wouldn't be in a git directory
+			// if the git folder is the sub-folder), but figured we can add a test
+			// just to codify what it would technically do in this situation.
+			name: "Completions for diff works when diffs are in sub-directory",
+
+			getwd: filepath.Join("/", "fake"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "--cached"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{
+						Stdout: []string{filepath.Join("/", "fake", "root")},
+					},
+					{
+						Stdout: []string{nameStatus(
+							"abc",
+							filepath.Join("def", "ghi"),
+							filepath.Join("some-folder", "123"),
+							filepath.Join("some-folder", "sub-folder", "456"),
+						)},
+					},
+					{},
+				},
+				Want: &command.Autocompletion{
+					Suggestions: []string{
+						filepath.Join("root", "abc"),
+						filepath.Join("root", "def", "ghi"),
+						filepath.Join("root", "some-folder", "123"),
+						filepath.Join("root", "some-folder", "sub-folder", "456"),
+					},
+				},
+			},
+		},
+		{
+			name:  "Completions for diff against parent branch",
 			getwd: filepath.Join("/", "fake", "root"),
+			g: &git{
+				RepoParentBranches: map[string]map[string]string{
+					fakeRepoID: {
+						"child": "parent",
+					},
+				},
+			},
 			ctc: &commandtest.CompleteTestCase{
-				Args:          "cmd d ",
+				Args:          "cmd d -P ",
 				SkipDataCheck: true,
 				WantRunContents: []*commandtest.RunContents{
 					{
 						Name: "git",
 						Args: []string{"rev-parse", "--show-toplevel"},
 					},
+					{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					repoIDRunContents(),
+					{Name: "git", Args: []string{"merge-base", "parent", "HEAD"}},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "abc123"},
+					},
 				},
 				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{"child"}},
+					{Stdout: []string{fakeRepoID}},
+					{Stdout: []string{"abc123"}},
+					{Stdout: []string{nameStatus("abc", filepath.Join("def", "ghi"))}},
+				},
+				Want: &command.Autocompletion{
+					Suggestions: []string{"abc", filepath.Join("def", "ghi")},
+				},
+			},
+		},
+		{
+			name:  "Completions for diff against parent branch fails if no parent branch",
+			getwd: filepath.Join("/", "fake", "root"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d -P ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
 					{
-						Err:    fmt.Errorf("oh no"),
-						Stdout: []string{"bloop"},
-						Stderr: []string{"blop"},
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
 					},
+					{Name: "git", Args: []string{"rev-parse", "--abbrev-ref", "HEAD"}},
+					repoIDRunContents(),
 				},
-				WantErr: fmt.Errorf("failed to get git root: failed to execute shell command: oh no"),
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{"child"}},
+					{Stdout: []string{fakeRepoID}},
+				},
+				WantErr: fmt.Errorf("branch child does not have a known parent branch"),
 			},
 		},
 		{
-			name:  "Completions for diff fails if git diff command fails",
+			name:  "Completions for diff include staged, deleted, and renamed files",
 			getwd: filepath.Join("/", "fake", "root"),
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd d ",
@@ -3192,24 +7627,25 @@ func TestAutocomplete(t *testing.T) {
 					},
 					{
 						Name: "git",
-						Args: []string{"diff", "--name-only"},
-					},
-				},
-				RunResponses: []*commandtest.FakeRun{
-					{
-						Stdout: []string{filepath.Join("/", "fake", "root")},
+						Args: []string{"diff", "--name-status", "-z"},
 					},
 					{
-						Err:    fmt.Errorf("whoops"),
-						Stdout: []string{"abc", "def"},
-						Stderr: []string{"ghi", "jkl", "mno"},
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "--cached"},
 					},
 				},
-				WantErr: fmt.Errorf("failed to get diffable files: failed to execute shell command: whoops"),
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{"M\x00abc\x00D\x00gone\x00"}},
+					{Stdout: []string{"M\x00abc\x00A\x00staged\x00R100\x00old\x00new\x00"}},
+				},
+				Want: &command.Autocompletion{
+					Suggestions: []string{"abc", "gone", "new", "old", "staged"},
+				},
 			},
 		},
 		{
-			name:  "Completions for diff fails if relative filepath fails",
+			name:  "Completions for diff fails if git diff output is invalid",
 			getwd: filepath.Join("/", "fake", "root"),
 			ctc: &commandtest.CompleteTestCase{
 				Args:          "cmd d ",
@@ -3221,25 +7657,21 @@ func TestAutocomplete(t *testing.T) {
 					},
 					{
 						Name: "git",
-						Args: []string{"diff", "--name-only"},
+						Args: []string{"diff", "--name-status", "-z"},
 					},
 				},
 				RunResponses: []*commandtest.FakeRun{
-					{
-						Stdout: []string{"not-absolute-path"},
-					},
-					{
-						Stdout: []string{"abc", "def"},
-					},
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{"R100\x00old\x00"}},
 				},
-				WantErr: fmt.Errorf("failed to get relative path: Rel: can't make %s relative to %s", filepath.Join("not-absolute-path", "abc"), filepath.Join("/", "fake", "root")),
+				WantErr: fmt.Errorf(`failed to get diffable files: missing path for diff status "R100"`),
 			},
 		},
 		{
-			name:  "Completions for diff works when in the same root",
+			name:  "Completions for diff against previous commit",
 			getwd: filepath.Join("/", "fake", "root"),
 			ctc: &commandtest.CompleteTestCase{
-				Args:          "cmd d ",
+				Args:          "cmd d -c ",
 				SkipDataCheck: true,
 				WantRunContents: []*commandtest.RunContents{
 					{
@@ -3248,102 +7680,97 @@ func TestAutocomplete(t *testing.T) {
 					},
 					{
 						Name: "git",
-						Args: []string{"diff", "--name-only"},
+						Args: []string{"diff", "--name-status", "-z", "@~1"},
 					},
 				},
 				RunResponses: []*commandtest.FakeRun{
-					{
-						Stdout: []string{filepath.Join("/", "fake", "root")},
-					},
-					{
-						Stdout: []string{"abc", filepath.Join("def", "ghi")},
-					},
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{nameStatus("abc")}},
 				},
 				Want: &command.Autocompletion{
-					Suggestions: []string{"abc", filepath.Join("def", "ghi")},
+					Suggestions: []string{"abc"},
 				},
 			},
 		},
 		{
-			name:  "Completions for diff works when diffs are in the parent directory",
-			getwd: filepath.Join("/", "fake", "root", "some-folder"),
+			name:  "Completions for diff against main branch",
+			getwd: filepath.Join("/", "fake", "root"),
+			g: &git{
+				MainBranches: map[string]string{
+					"some-repo": "trunk",
+				},
+			},
 			ctc: &commandtest.CompleteTestCase{
-				Args:          "cmd d ",
+				Args:          "cmd d -m ",
 				SkipDataCheck: true,
 				WantRunContents: []*commandtest.RunContents{
 					{
 						Name: "git",
 						Args: []string{"rev-parse", "--show-toplevel"},
 					},
+					repoRunContents(),
 					{
 						Name: "git",
-						Args: []string{"diff", "--name-only"},
+						Args: []string{"diff", "--name-status", "-z", "trunk"},
 					},
 				},
 				RunResponses: []*commandtest.FakeRun{
-					{
-						Stdout: []string{filepath.Join("/", "fake", "root")},
-					},
-					{
-						Stdout: []string{
-							"abc",
-							filepath.Join("def", "ghi"),
-							filepath.Join("some-folder", "123"),
-							filepath.Join("some-folder", "sub-folder", "456"),
-						},
-					},
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{"some-repo"}},
+					{Stdout: []string{nameStatus("abc", "def")}},
 				},
 				Want: &command.Autocompletion{
-					Suggestions: []string{
-						filepath.Join("..", "abc"),
-						filepath.Join("..", "def", "ghi"),
-						filepath.Join("123"),
-						filepath.Join("sub-folder", "456"),
-					},
+					Suggestions: []string{"abc", "def"},
 				},
 			},
 		},
 		{
-			// This wouldn't ever really happen (as we wouldn't be in a git directory
-			// if the git folder is the sub-folder), but figured we can add a test
-			// just to codify what it would technically do in this situation.
-			name: "Completions for diff works when diffs are in sub-directory",
-
-			getwd: filepath.Join("/", "fake"),
+			name:  "Completions for diff against detected main branch doesn't cache the branch",
+			getwd: filepath.Join("/", "fake", "root"),
 			ctc: &commandtest.CompleteTestCase{
-				Args:          "cmd d ",
+				Args:          "cmd d -m ",
 				SkipDataCheck: true,
 				WantRunContents: []*commandtest.RunContents{
 					{
 						Name: "git",
 						Args: []string{"rev-parse", "--show-toplevel"},
 					},
+					repoRunContents(),
+					remoteHeadRunContents(),
 					{
 						Name: "git",
-						Args: []string{"diff", "--name-only"},
+						Args: []string{"diff", "--name-status", "-z", "develop"},
 					},
 				},
 				RunResponses: []*commandtest.FakeRun{
-					{
-						Stdout: []string{filepath.Join("/", "fake", "root")},
-					},
-					{
-						Stdout: []string{
-							"abc",
-							filepath.Join("def", "ghi"),
-							filepath.Join("some-folder", "123"),
-							filepath.Join("some-folder", "sub-folder", "456"),
-						},
-					},
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Stdout: []string{"git@github.com:user/repo.git"}},
+					{Stdout: []string{"origin/develop"}},
+					{Stdout: []string{nameStatus("abc", "def")}},
 				},
 				Want: &command.Autocompletion{
-					Suggestions: []string{
-						filepath.Join("root", "abc"),
-						filepath.Join("root", "def", "ghi"),
-						filepath.Join("root", "some-folder", "123"),
-						filepath.Join("root", "some-folder", "sub-folder", "456"),
+					Suggestions: []string{"abc", "def"},
+				},
+			},
+		},
+		{
+			name:  "Completions for diff against main branch fails if remote url fails",
+			getwd: filepath.Join("/", "fake", "root"),
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd d -m ",
+				SkipDataCheck: true,
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
 					},
+					repoRunContents(),
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{filepath.Join("/", "fake", "root")}},
+					{Err: fmt.Errorf("oops")},
 				},
+				WantErr: fmt.Errorf("failed to get remote url: failed to execute shell command: oops"),
 			},
 		},
 		{
@@ -3362,7 +7789,11 @@ func TestAutocomplete(t *testing.T) {
 					},
 					{
 						Name: "git",
-						Args: []string{"diff", "--name-only"},
+						Args: []string{"diff", "--name-status", "-z"},
+					},
+					{
+						Name: "git",
+						Args: []string{"diff", "--name-status", "-z", "--cached"},
 					},
 				},
 				RunResponses: []*commandtest.FakeRun{
@@ -3370,8 +7801,9 @@ func TestAutocomplete(t *testing.T) {
 						Stdout: []string{filepath.Join("/", "fake", "root")},
 					},
 					{
-						Stdout: []string{"abc", "def"},
+						Stdout: []string{nameStatus("abc", "def")},
 					},
+					{},
 				},
 			},
 		},
@@ -3393,6 +7825,96 @@ func TestAutocomplete(t *testing.T) {
 				}},
 			},
 		},
+		{
+			// The suggestions are sorted by the completion framework (see
+			// TestRecentBranchCompleter for the order of the completion itself).
+			name: "Branch completions suggests every branch when history exists",
+			g: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/git/root":   {{Branch: "z-recent"}, {Branch: "a-older"}},
+					"/other/root": {{Branch: "other"}},
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd ch ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"a-older", "b-unvisited", "z-recent"},
+				},
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"branch", "--list"},
+					},
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"  a-older", "  b-unvisited", "* current", "  z-recent"}},
+					{Stdout: []string{"/git/root"}},
+				},
+			},
+		},
+		{
+			name: "Branch completions filters recent branches by the typed prefix",
+			g: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/git/root": {{Branch: "b-3"}, {Branch: "a-older"}},
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd ch b",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"b-1", "b-3"},
+				},
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"branch", "--list"},
+					},
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"  a-older", "  b-1 ", "* 	b-2", "		b-3		"}},
+					{Stdout: []string{"/git/root"}},
+				},
+			},
+		},
+		{
+			name: "Branch completions uses all branches if no history for repo",
+			g: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/other/root": {{Branch: "other"}},
+				},
+			},
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd ch ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"b-1", "b-3"},
+				},
+				WantRunContents: []*commandtest.RunContents{
+					{
+						Name: "git",
+						Args: []string{"branch", "--list"},
+					},
+					{
+						Name: "git",
+						Args: []string{"rev-parse", "--show-toplevel"},
+					},
+				},
+				RunResponses: []*commandtest.FakeRun{
+					{Stdout: []string{"  b-1 ", "* 	b-2", "		b-3		"}},
+					{Stdout: []string{"/git/root"}},
+				},
+			},
+		},
 		{
 			name: "Handles no	branch completions",
 			ctc: &commandtest.CompleteTestCase{
@@ -3417,7 +7939,7 @@ func TestAutocomplete(t *testing.T) {
 				RunResponses: []*commandtest.FakeRun{{
 					Err: fmt.Errorf("oops"),
 				}},
-				WantErr: fmt.Errorf("failed to fetch autocomplete suggestions with shell command: failed to execute shell command: oops"),
+				WantErr: fmt.Errorf("failed to get git branches: failed to execute shell command: oops"),
 			},
 		},
 		{
@@ -3509,7 +8031,55 @@ func TestAutocomplete(t *testing.T) {
 				RunResponses: []*commandtest.FakeRun{{
 					Err: fmt.Errorf("oh no"),
 				}},
-				WantErr: fmt.Errorf("failed to fetch autocomplete suggestions with shell command: failed to execute shell command: oh no"),
+				WantErr: fmt.Errorf("failed to get git branches: failed to execute shell command: oh no"),
+			},
+		},
+		{
+			name: "Conflict completions only suggest conflicted files",
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd theirs a.go ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"b.go", "c.go"},
+				},
+				WantRunContents: []*commandtest.RunContents{{
+					Name: "git",
+					Args: []string{"status", "--porcelain=v2", "-z"},
+				}},
+				RunResponses: []*commandtest.FakeRun{{
+					Stdout: []string{strings.Join([]string{
+						"u UU N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b a.go",
+						"1 .M N... 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be modified.go",
+						"u AA N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b b.go",
+						"? untracked.go",
+						"u UD N... 100644 100644 100644 100644 7efc2d1ea4fa9c61329411bae30090ff3d0cf2be e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9 49cc8ef0e116cef009fe0bd72473a964bbd07f9b c.go",
+						"",
+					}, "\x00")},
+				}},
+			},
+		},
+		{
+			name: "Worktree completions",
+			ctc: &commandtest.CompleteTestCase{
+				Args:          "cmd wt cd ",
+				SkipDataCheck: true,
+				Want: &command.Autocompletion{
+					Suggestions: []string{"feature", "main", "person/feature"},
+				},
+				WantRunContents: []*commandtest.RunContents{{
+					Name: "git",
+					Args: []string{"worktree", "list", "--porcelain"},
+				}},
+				RunResponses: []*commandtest.FakeRun{{
+					Stdout: []string{
+						"worktree /repos/repo",
+						"branch refs/heads/main",
+						"worktree /repos/repo-feature",
+						"branch refs/heads/person/feature",
+						"worktree /repos/repo-detached",
+						"detached",
+					},
+				}},
 			},
 		},
 		/* Useful for commenting out tests. */
@@ -3521,9 +8091,16 @@ func TestAutocomplete(t *testing.T) {
 			test.ctc.Env = map[string]string{
 				"USER": "person",
 			}
-			g := &git{}
+			g := test.g
+			if g == nil {
+				g = &git{}
+			}
 			test.ctc.Node = g.Node()
 			commandertest.AutocompleteTest(t, test.ctc)
+			// Completion must never change the persisted config.
+			if g.Changed() {
+				t.Errorf("Autocomplete(%s) changed the config: %+v", test.ctc.Args, g)
+			}
 		})
 	}
 }
@@ -3540,13 +8117,11 @@ func TestMetadata(t *testing.T) {
 		g.Setup()
 	})
 
-	t.Run("Fails if unknown OS", func(t *testing.T) {
+	t.Run("Uses POSIX shell if unknown OS", func(t *testing.T) {
 		etc := &commandtest.ExecuteTestCase{
 			Node:            g.Node(),
 			Args:            []string{"pp"},
-			WantErr:         fmt.Errorf(`Unknown OS ("other")`),
-			WantStderr:      "Unknown OS (\"other\")\n",
-			WantExecuteData: &command.ExecuteData{Executable: []string{""}, FunctionWrap: true},
+			WantExecuteData: &command.ExecuteData{Executable: []string{"", "git pull && git push"}, FunctionWrap: true},
 		}
 		fos := &fakeOS{sourcerer.Linux(), "other"}
 		commandtest.StubValue(t, &sourcerer.CurrentOS, fos.os())
@@ -3562,3 +8137,102 @@ type fakeOS struct {
 
 func (f *fakeOS) Name() string     { return f.name }
 func (f *fakeOS) os() sourcerer.OS { return f }
+
+func TestUnmarshalJSON(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		json        string
+		want        *git
+		wantLegacy  map[string]string
+		wantChanged bool
+	}{
+		{
+			name: "loads branch history",
+			json: `{"DefaultBranch":"trunk","BranchHistory":{"/repo":[{"Branch":"a","Time":"2026-03-04T05:06:07Z"},{"Branch":"b","Time":"0001-01-01T00:00:00Z"}]}}`,
+			want: &git{
+				DefaultBranch: "trunk",
+				BranchHistory: map[string][]*BranchVisit{
+					"/repo": {
+						{Branch: "a", Time: time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC)},
+						{Branch: "b"},
+					},
+				},
+			},
+		},
+		{
+			name: "migrates previous branches",
+			json: `{"ParentBranches":{"a":"main"},"PreviousBranches":{"/repo":"a","/other":"b"}}`,
+			want: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/repo":  {{Branch: "a"}},
+					"/other": {{Branch: "b"}},
+				},
+			},
+			wantLegacy: map[string]string{
+				"a": "main",
+			},
+			wantChanged: true,
+		},
+		{
+			name: "keeps repo parent branches",
+			json: `{"RepoParentBranches":{"/repo/.git":{"a":"main"}}}`,
+			want: &git{
+				RepoParentBranches: map[string]map[string]string{
+					"/repo/.git": {"a": "main"},
+				},
+			},
+		},
+		{
+			name: "keeps stopped restacks",
+			json: `{"Restacks":{"/repo/.git":{"Branch":"a","Merge":true}}}`,
+			want: &git{
+				Restacks: map[string]*Restack{
+					"/repo/.git": {Branch: "a", Merge: true},
+				},
+			},
+		},
+		{
+			name: "does not overwrite existing branch history when migrating",
+			json: `{"PreviousBranches":{"/repo":"a","/other":"b"},"BranchHistory":{"/repo":[{"Branch":"c","Time":"0001-01-01T00:00:00Z"}]}}`,
+			want: &git{
+				BranchHistory: map[string][]*BranchVisit{
+					"/repo":  {{Branch: "c"}},
+					"/other": {{Branch: "b"}},
+				},
+			},
+			wantChanged: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			g := &git{}
+			if err := json.Unmarshal([]byte(test.json), g); err != nil {
+				t.Fatalf("json.Unmarshal(%s) returned error: %v", test.json, err)
+			}
+			if diff := cmp.Diff(test.want, g, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("json.Unmarshal(%s) produced incorrect git (-want, +got):\n%s", test.json, diff)
+			}
+			if diff := cmp.Diff(test.wantLegacy, g.legacyParentBranches, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("json.Unmarshal(%s) produced incorrect legacy parent branches (-want, +got):\n%s", test.json, diff)
+			}
+			if got := g.Changed(); got != test.wantChanged {
+				t.Errorf("json.Unmarshal(%s) set Changed() to %v; want %v", test.json, got, test.wantChanged)
+			}
+
+			// Marshaling and unmarshaling again shouldn't lose anything.
+			b, err := json.Marshal(g)
+			if err != nil {
+				t.Fatalf("json.Marshal(%v) returned error: %v", g, err)
+			}
+			reloaded := &git{}
+			if err := json.Unmarshal(b, reloaded); err != nil {
+				t.Fatalf("json.Unmarshal(%s) returned error: %v", string(b), err)
+			}
+			if diff := cmp.Diff(test.want, reloaded, cmpopts.IgnoreUnexported(git{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("json.Unmarshal(%s) produced incorrect git (-want, +got):\n%s", string(b), diff)
+			}
+			if diff := cmp.Diff(test.wantLegacy, reloaded.legacyParentBranches, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("json.Unmarshal(%s) produced incorrect legacy parent branches (-want, +got):\n%s", string(b), diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+)
+
+// StatusEntryType is the type of a `git status --porcelain=v2` record.
+type StatusEntryType string
+
+const (
+	// OrdinaryEntry is a changed tracked file.
+	OrdinaryEntry StatusEntryType = "1"
+	// RenamedEntry is a renamed or copied tracked file.
+	RenamedEntry StatusEntryType = "2"
+	// UnmergedEntry is a file with merge conflicts.
+	UnmergedEntry StatusEntryType = "u"
+	// UntrackedEntry is an untracked file.
+	UntrackedEntry StatusEntryType = "?"
+	// IgnoredEntry is an ignored file.
+	IgnoredEntry StatusEntryType = "!"
+)
+
+// StatusEntry is a single record from `git status --porcelain=v2 -z`. See
+// https://git-scm.com/docs/git-status#_porcelain_format_version_2 for details
+// on each field.
+type StatusEntry struct {
+	Type StatusEntryType
+	// XY is the staged (X) and unstaged (Y) state of the file, where `.` means
+	// unmodified. This is empty for untracked and ignored files.
+	XY string
+	// Sub is the submodule state (e.g. `N...` for files that aren't submodules).
+	Sub string
+	// Modes are the file modes. Ordinary and renamed entries have the HEAD,
+	// index, and worktree modes. Unmerged entries have the stage 1, 2, and 3
+	// modes followed by the worktree mode.
+	Modes []string
+	// Hashes are the object names. Ordinary and renamed entries have the HEAD
+	// and index object names. Unmerged entries have the stage 1, 2, and 3 object
+	// names.
+	Hashes []string
+	// Score is the rename or copy score (e.g. `R100`) of renamed entries.
+	Score string
+	// Path is the path of the file.
+	Path string
+	// OrigPath is the path that a renamed entry was renamed (or copied) from.
+	OrigPath string
+}
+
+// Staged returns the staged state of the file.
+func (e *StatusEntry) Staged() byte {
+	if len(e.XY) != 2 {
+		return '.'
+	}
+	return e.XY[0]
+}
+
+// Unstaged returns the unstaged state of the file.
+func (e *StatusEntry) Unstaged() byte {
+	if len(e.XY) != 2 {
+		return '.'
+	}
+	return e.XY[1]
+}
+
+// ParseStatus parses the output of `git status --porcelain=v2 -z`. Header
+// lines (from the `--branch` option) are ignored.
+func ParseStatus(out string) ([]*StatusEntry, error) {
+	records := strings.Split(out, "\x00")
+	var r []*StatusEntry
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record == "" || strings.HasPrefix(record, "# ") {
+			continue
+		}
+
+		t, rest, _ := strings.Cut(record, " ")
+		switch StatusEntryType(t) {
+		case OrdinaryEntry:
+			// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+			parts := strings.SplitN(rest, " ", 8)
+			if len(parts) != 8 {
+				return nil, fmt.Errorf("invalid ordinary status entry: %q", record)
+			}
+			r = append(r, &StatusEntry{
+				Type:   OrdinaryEntry,
+				XY:     parts[0],
+				Sub:    parts[1],
+				Modes:  parts[2:5],
+				Hashes: parts[5:7],
+				Path:   parts[7],
+			})
+		case RenamedEntry:
+			// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>NUL<origPath>
+			parts := strings.SplitN(rest, " ", 9)
+			if len(parts) != 9 || i+1 >= len(records) {
+				return nil, fmt.Errorf("invalid renamed status entry: %q", record)
+			}
+			i++
+			r = append(r, &StatusEntry{
+				Type:     RenamedEntry,
+				XY:       parts[0],
+				Sub:      parts[1],
+				Modes:    parts[2:5],
+				Hashes:   parts[5:7],
+				Score:    parts[7],
+				Path:     parts[8],
+				OrigPath: records[i],
+			})
+		case UnmergedEntry:
+			// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			parts := strings.SplitN(rest, " ", 10)
+			if len(parts) != 10 {
+				return nil, fmt.Errorf("invalid unmerged status entry: %q", record)
+			}
+			r = append(r, &StatusEntry{
+				Type:   UnmergedEntry,
+				XY:     parts[0],
+				Sub:    parts[1],
+				Modes:  parts[2:6],
+				Hashes: parts[6:9],
+				Path:   parts[9],
+			})
+		case UntrackedEntry, IgnoredEntry:
+			// ? <path>
+			if rest == "" {
+				return nil, fmt.Errorf("invalid status entry: %q", record)
+			}
+			r = append(r, &StatusEntry{
+				Type: StatusEntryType(t),
+				Path: rest,
+			})
+		default:
+			return nil, fmt.Errorf("unknown status entry type: %q", record)
+		}
+	}
+	return r, nil
+}
+
+// gitStatus returns the status entries of the worktree in dir (or of the
+// current directory if dir is empty).
+func gitStatus(r GitRunner, d *command.Data, dir string) ([]*StatusEntry, error) {
+	entries, err := r.Status(nil, d, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git status: %v", err)
+	}
+	return entries, nil
+}
+
+// parseNameStatus parses the output of `git diff --name-status -z` into the
+// changed paths. Renames and copies include both the source and target paths.
+func parseNameStatus(out string) ([]string, error) {
+	records := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	var r []string
+	for i := 0; i < len(records); i++ {
+		status := records[i]
+		if status == "" {
+			continue
+		}
+		n := 1
+		if status[0] == 'R' || status[0] == 'C' {
+			n = 2
+		}
+		if i+n >= len(records) {
+			return nil, fmt.Errorf("missing path for diff status %q", status)
+		}
+		r = append(r, records[i+1:i+1+n]...)
+		i += n
+	}
+	return r, nil
+}
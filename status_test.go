@@ -0,0 +1,210 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseStatus(t *testing.T) {
+	h1 := "7efc2d1ea4fa9c61329411bae30090ff3d0cf2be"
+	h2 := "e4680edc5a0a0f60ae4e01414f711e6a55a8d8d9"
+	h3 := "49cc8ef0e116cef009fe0bd72473a964bbd07f9b"
+	z := func(records ...string) string {
+		return strings.Join(records, "\x00") + "\x00"
+	}
+
+	for _, test := range []struct {
+		name    string
+		out     string
+		want    []*StatusEntry
+		wantErr error
+	}{
+		{
+			name: "empty output",
+		},
+		{
+			name: "ordinary entry",
+			out:  z(fmt.Sprintf("1 .M N... 100644 100644 100644 %s %s file.go", h1, h1)),
+			want: []*StatusEntry{{
+				Type:   OrdinaryEntry,
+				XY:     ".M",
+				Sub:    "N...",
+				Modes:  []string{"100644", "100644", "100644"},
+				Hashes: []string{h1, h1},
+				Path:   "file.go",
+			}},
+		},
+		{
+			name: "paths with spaces, quotes, tabs, and unicode",
+			out: z(
+				fmt.Sprintf("1 M. N... 100644 100644 100644 %s %s dir/with spaces \"and\" quotes.go", h1, h2),
+				"? tab\there/ünïcode.go",
+			),
+			want: []*StatusEntry{
+				{
+					Type:   OrdinaryEntry,
+					XY:     "M.",
+					Sub:    "N...",
+					Modes:  []string{"100644", "100644", "100644"},
+					Hashes: []string{h1, h2},
+					Path:   "dir/with spaces \"and\" quotes.go",
+				},
+				{
+					Type: UntrackedEntry,
+					Path: "tab\there/ünïcode.go",
+				},
+			},
+		},
+		{
+			name: "renamed entry",
+			out: z(
+				fmt.Sprintf("2 RM N... 100644 100644 100644 %s %s R087 new name.go", h1, h1),
+				"old name.go",
+				"? other.go",
+			),
+			want: []*StatusEntry{
+				{
+					Type:     RenamedEntry,
+					XY:       "RM",
+					Sub:      "N...",
+					Modes:    []string{"100644", "100644", "100644"},
+					Hashes:   []string{h1, h1},
+					Score:    "R087",
+					Path:     "new name.go",
+					OrigPath: "old name.go",
+				},
+				{
+					Type: UntrackedEntry,
+					Path: "other.go",
+				},
+			},
+		},
+		{
+			name: "copied entry",
+			out:  z(fmt.Sprintf("2 C. N... 100644 100644 100644 %s %s C100 copy.go", h1, h1), "orig.go"),
+			want: []*StatusEntry{{
+				Type:     RenamedEntry,
+				XY:       "C.",
+				Sub:      "N...",
+				Modes:    []string{"100644", "100644", "100644"},
+				Hashes:   []string{h1, h1},
+				Score:    "C100",
+				Path:     "copy.go",
+				OrigPath: "orig.go",
+			}},
+		},
+		{
+			name: "unmerged entry",
+			out:  z(fmt.Sprintf("u UU N... 100644 100644 100644 100644 %s %s %s conflict.go", h1, h2, h3)),
+			want: []*StatusEntry{{
+				Type:   UnmergedEntry,
+				XY:     "UU",
+				Sub:    "N...",
+				Modes:  []string{"100644", "100644", "100644", "100644"},
+				Hashes: []string{h1, h2, h3},
+				Path:   "conflict.go",
+			}},
+		},
+		{
+			name: "ignored entry and headers",
+			out:  z("# branch.oid "+h1, "# branch.head main", "! build/out.o"),
+			want: []*StatusEntry{{
+				Type: IgnoredEntry,
+				Path: "build/out.o",
+			}},
+		},
+		{
+			name: "submodule entry",
+			out:  z(fmt.Sprintf("1 .M SC.. 160000 160000 160000 %s %s sub", h1, h1)),
+			want: []*StatusEntry{{
+				Type:   OrdinaryEntry,
+				XY:     ".M",
+				Sub:    "SC..",
+				Modes:  []string{"160000", "160000", "160000"},
+				Hashes: []string{h1, h1},
+				Path:   "sub",
+			}},
+		},
+		{
+			name:    "fails for truncated ordinary entry",
+			out:     z("1 .M N... 100644"),
+			wantErr: fmt.Errorf(`invalid ordinary status entry: "1 .M N... 100644"`),
+		},
+		{
+			name:    "fails for renamed entry without original path",
+			out:     fmt.Sprintf("2 R. N... 100644 100644 100644 %s %s R100 new.go", h1, h1),
+			wantErr: fmt.Errorf(`invalid renamed status entry: "2 R. N... 100644 100644 100644 %s %s R100 new.go"`, h1, h1),
+		},
+		{
+			name:    "fails for truncated unmerged entry",
+			out:     z("u UU N... 100644"),
+			wantErr: fmt.Errorf(`invalid unmerged status entry: "u UU N... 100644"`),
+		},
+		{
+			name:    "fails for untracked entry without path",
+			out:     z("?"),
+			wantErr: fmt.Errorf(`invalid status entry: "?"`),
+		},
+		{
+			name:    "fails for unknown entry type",
+			out:     z("x file.go"),
+			wantErr: fmt.Errorf(`unknown status entry type: "x file.go"`),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseStatus(test.out)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ParseStatus(%q) returned diff (-want, +got):\n%s", test.out, diff)
+			}
+			if diff := cmp.Diff(fmt.Sprintf("%v", test.wantErr), fmt.Sprintf("%v", err)); diff != "" {
+				t.Errorf("ParseStatus(%q) returned error diff (-want, +got):\n%s", test.out, diff)
+			}
+		})
+	}
+}
+
+func TestParseNameStatus(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		out     string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "empty output",
+		},
+		{
+			name: "modified, added, and deleted files",
+			out:  "M\x00a.go\x00A\x00dir/b c.go\x00D\x00d.go\x00",
+			want: []string{"a.go", "dir/b c.go", "d.go"},
+		},
+		{
+			name: "renamed and copied files",
+			out:  "R087\x00old.go\x00new.go\x00C100\x00orig.go\x00copy.go\x00M\x00e.go\x00",
+			want: []string{"old.go", "new.go", "orig.go", "copy.go", "e.go"},
+		},
+		{
+			name:    "fails for missing path",
+			out:     "M\x00",
+			wantErr: fmt.Errorf(`missing path for diff status "M"`),
+		},
+		{
+			name:    "fails for rename without target",
+			out:     "R100\x00old.go\x00",
+			wantErr: fmt.Errorf(`missing path for diff status "R100"`),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseNameStatus(test.out)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseNameStatus(%q) returned diff (-want, +got):\n%s", test.out, diff)
+			}
+			if diff := cmp.Diff(fmt.Sprintf("%v", test.wantErr), fmt.Sprintf("%v", err)); diff != "" {
+				t.Errorf("parseNameStatus(%q) returned error diff (-want, +got):\n%s", test.out, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package sourcecontrol
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"github.com/leep-frog/command/commander"
+)
+
+var (
+	wtPathArg   = commander.OptionalArg[string]("PATH", "Directory to create the worktree in (defaults to a sibling of the main worktree)")
+	wtForceFlag = commander.BoolFlag("force", 'f', "Remove the worktree even if it has uncommitted changes")
+)
+
+// worktrees returns all of the repo's worktrees. The main worktree is always
+// the first entry.
+func worktrees(r GitRunner, d *command.Data) ([]*Worktree, error) {
+	wts, err := r.Worktrees(nil, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %v", err)
+	}
+	return wts, nil
+}
+
+// findWorktree returns the worktree that has the provided branch checked out.
+// The branch is resolved with the user prefix just like other branch args.
+func findWorktree(r GitRunner, d *command.Data, branch string) (*Worktree, error) {
+	wts, err := worktrees(r, d)
+	if err != nil {
+		return nil, err
+	}
+
+	var bs []string
+	for _, wt := range wts {
+		bs = append(bs, wt.Branch)
+	}
+	branch = resolveBranch(branch, bs, d)
+	for _, wt := range wts {
+		if wt.Branch != "" && wt.Branch == branch {
+			return wt, nil
+		}
+	}
+	return nil, fmt.Errorf("no worktree has branch %s checked out", branch)
+}
+
+// worktreeCompleter completes the branches that are checked out in worktrees.
+func worktreeCompleter(r GitRunner) commander.Completer[string] {
+	return commander.CompleterFromFunc(func(s string, d *command.Data) (*command.Completion, error) {
+		wts, err := worktrees(r, d)
+		if err != nil {
+			return nil, err
+		}
+
+		userPrefix := fmt.Sprintf("%s/", userArg.Get(d))
+		var suggestions []string
+		for _, wt := range wts {
+			if wt.Branch == "" {
+				continue
+			}
+			suggestions = append(suggestions, wt.Branch)
+			if suffix, ok := strings.CutPrefix(wt.Branch, userPrefix); ok {
+				suggestions = append(suggestions, suffix)
+			}
+		}
+		return &command.Completion{
+			Suggestions: suggestions,
+		}, nil
+	})
+}
+
+// worktreeNode returns the node for managing worktrees.
+func (g *git) worktreeNode() command.Node {
+	runner := g.gitRunner()
+	wtBranchArg := commander.Arg(
+		"BRANCH",
+		"Branch",
+		branchCompleter(runner),
+		branchTransformer(runner),
+	)
+	wtArg := commander.Arg[string](
+		"BRANCH",
+		"Branch checked out in the worktree",
+		worktreeCompleter(runner),
+	)
+
+	return &commander.BranchNode{
+		Branches: map[string]command.Node{
+			"add": commander.SerialNodes(
+				commander.Description("Create a worktree for a branch and cd into it"),
+				commander.FlagProcessor(
+					newBranchFlag,
+				),
+				currentBranchArg.processor(runner),
+				userArg,
+				wtBranchArg,
+				wtPathArg,
+				g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+					branch := wtBranchArg.Get(d)
+					path := wtPathArg.Get(d)
+					if !wtPathArg.Provided(d) {
+						wts, err := worktrees(runner, d)
+						if err != nil {
+							return nil, o.Err(err)
+						}
+						if len(wts) == 0 {
+							return nil, o.Stderrln("no main worktree found")
+						}
+						mainPath := wts[0].Path
+						path = filepath.Join(filepath.Dir(mainPath), fmt.Sprintf("%s-%s", filepath.Base(mainPath), strings.ReplaceAll(branch, "/", "-")))
+					}
+
+					add := []string{"worktree", "add", path, branch}
+					if newBranchFlag.Get(d) {
+						if err := g.loadRepoParents(o, d); err != nil {
+							return nil, o.Err(err)
+						}
+						g.setParentBranch(branch, currentBranchArg.Get(d))
+						add = []string{"worktree", "add", "-b", branch, path}
+					}
+					return &execution{
+						git: [][]string{add},
+						cd:  path,
+					}, nil
+				}),
+			),
+			"ls": commander.SerialNodes(
+				commander.Description("List worktrees"),
+				&commander.ExecutorProcessor{F: func(o command.Output, d *command.Data) error {
+					wts, err := worktrees(runner, d)
+					if err != nil {
+						return o.Err(err)
+					}
+					for _, wt := range wts {
+						branch := wt.Branch
+						if branch == "" {
+							branch = "detached"
+						}
+						o.Stdoutf("%s (%s)\n", wt.Path, branch)
+					}
+					return nil
+				}},
+			),
+			"rm": commander.SerialNodes(
+				commander.Description("Remove a worktree"),
+				commander.FlagProcessor(
+					wtForceFlag,
+				),
+				userArg,
+				wtArg,
+				g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+					wt, err := findWorktree(runner, d, wtArg.Get(d))
+					if err != nil {
+						return nil, o.Err(err)
+					}
+
+					args := []string{"worktree", "remove"}
+					if wtForceFlag.Get(d) {
+						args = append(args, "--force")
+					} else {
+						changes, err := gitStatus(runner, d, wt.Path)
+						if err != nil {
+							return nil, o.Err(err)
+						}
+						if len(changes) > 0 {
+							return nil, o.Stderrf("worktree %s has uncommitted changes (use --force to remove it anyway)\n", wt.Path)
+						}
+					}
+					return gitExecution(append(args, wt.Path)), nil
+				}),
+			),
+			"cd": commander.SerialNodes(
+				commander.Description("cd into the worktree for a branch"),
+				userArg,
+				wtArg,
+				g.executable(func(o command.Output, d *command.Data) (*execution, error) {
+					wt, err := findWorktree(runner, d, wtArg.Get(d))
+					if err != nil {
+						return nil, o.Err(err)
+					}
+					return &execution{cd: wt.Path}, nil
+				}),
+			),
+		},
+	}
+}